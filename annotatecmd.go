@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// annotate marks the selected items as favorites, rates them or attaches a note. Without changes it prints the
+// annotations of the selected items, without a selection those of all favorites
+func annotate(args []string) int {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	favorite := fs.Bool("favorite", false, "mark the items as favorites. Use -favorite=false to unmark them")
+	note := fs.String("note", "", "attach this note to the items. An empty note removes it")
+	rating := fs.Int("rating", 0, fmt.Sprintf("rate the items from 1 to %d. 0 removes the rating", db.MaxRating))
+	sel := registerSelectionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: annotate [-archive dir] [-favorite[=false]] [-note text] [-rating n] [-guid guid]... [-q text] [-from date] [-to date]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var an db.Annotation
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "favorite":
+			an.Favorite = favorite
+		case "note":
+			an.Note = note
+		case "rating":
+			an.Rating = rating
+		}
+	})
+	err := an.Validate()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	a := db.NewArchive(filepath.Join(*dir, "archive.json"))
+	a.Read()
+
+	changes := an.Favorite != nil || an.Note != nil || an.Rating != nil
+	if changes && sel.empty() {
+		fmt.Println("Select the items to annotate via -guid, -q, -from or -to")
+		return 2
+	}
+
+	items := db.Favorites(a.Data.Items)
+	if !sel.empty() {
+		guids, err := sel.match(a.Data.Items)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		items = nil
+		for _, i := range a.Data.Items {
+			if contains(guids, i.Guid) {
+				items = append(items, i)
+			}
+		}
+	}
+
+	if !changes {
+		for _, i := range items {
+			printAnnotations(i)
+		}
+		return 0
+	}
+
+	for _, i := range items {
+		a.Annotate(i.Guid, an)
+	}
+	err = a.Persist()
+	if err != nil {
+		fmt.Println("Error persisting archive:", err)
+		return 1
+	}
+	fmt.Printf("Annotated %d items\n", len(items))
+
+	return 0
+}
+
+// printAnnotations prints an item with its favorite mark, rating and note
+func printAnnotations(i db.Item) {
+	mark := " "
+	if i.Favorite {
+		mark = "*"
+	}
+	rating := strings.Repeat("+", i.Rating) + strings.Repeat("-", db.MaxRating-i.Rating)
+	fmt.Printf("%s %s  %s  %s\n", mark, rating, i.Filename, i.Guid)
+	if i.Note != "" {
+		fmt.Printf("    %s\n", i.Note)
+	}
+}
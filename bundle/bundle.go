@@ -0,0 +1,415 @@
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/sidecar"
+)
+
+// names of the entries inside a bundle
+const (
+	manifestJson = "manifest.json"
+	manifestCsv  = "manifest.csv"
+	mediaDir     = "media/"
+	metaDir      = "meta/"
+)
+
+// Format returns the bundle format for the given filename, "zip" or "tar.gz", or an error for unknown extensions
+func Format(filename string) (string, error) {
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		return "tar.gz", nil
+	}
+
+	return "", errors.New(fmt.Sprintf("Unknown bundle format of %s. Use .zip, .tar.gz or .tgz", filename))
+}
+
+// writer abstracts adding files to zip and tar archives
+type writer interface {
+	add(name string, size int64, r io.Reader) error
+	Close() error
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (z zipWriter) add(name string, size int64, r io.Reader) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+
+	return err
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+	gw *gzip.Writer
+}
+
+func (t tarWriter) add(name string, size int64, r io.Reader) error {
+	err := t.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tw, r)
+
+	return err
+}
+
+func (t tarWriter) Close() error {
+	err := t.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return t.gw.Close()
+}
+
+// Export writes all items of the archive in archiveDir into a bundle at the given path. The bundle contains
+// the media, a manifest of all items as json and csv, and the sidecars of all items that have one.
+// Media missing in the archive is left out of the bundle. Their filenames are returned
+func Export(archiveDir, bundlePath string) ([]string, error) {
+	format, err := Format(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	a := db.NewArchive(filepath.Join(archiveDir, "archive.json"))
+	a.Read()
+
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var w writer
+	if format == "zip" {
+		w = zipWriter{zip.NewWriter(f)}
+	} else {
+		gw := gzip.NewWriter(f)
+		w = tarWriter{tar.NewWriter(gw), gw}
+	}
+
+	// the manifest comes first, so imports of tar bundles know all items before reaching the media
+	manifest, err := json.MarshalIndent(a.Data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = w.add(manifestJson, int64(len(manifest)), strings.NewReader(string(manifest)))
+	if err != nil {
+		return nil, err
+	}
+	csvData := manifestToCsv(a.Data.Items)
+	err = w.add(manifestCsv, int64(len(csvData)), strings.NewReader(csvData))
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	sidecars := sidecarsByFile(archiveDir)
+	// items may share a file, which is added only once
+	added := map[string]bool{}
+	for _, i := range a.Data.Items {
+		if added[i.Filename] {
+			continue
+		}
+		added[i.Filename] = true
+		err := addFile(w, filepath.Join(archiveDir, i.Filename), mediaDir+i.Filename)
+		if os.IsNotExist(err) {
+			missing = append(missing, i.Filename)
+			continue
+		}
+		if err != nil {
+			return missing, err
+		}
+		for _, meta := range sidecars[i.Filename] {
+			err = addFile(w, filepath.Join(archiveDir, meta), metaDir+meta)
+			if err != nil {
+				return missing, err
+			}
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return missing, err
+	}
+
+	return missing, f.Close()
+}
+
+// sidecarsByFile maps the archived files to the names of their sidecars. Items sharing a file have one sidecar each,
+// so besides a.gif.meta.json there may be a.gif-1.meta.json and so on
+func sidecarsByFile(archiveDir string) map[string][]string {
+	files, _ := ioutil.ReadDir(archiveDir)
+	sidecars := map[string][]string{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), sidecar.Suffix) {
+			continue
+		}
+		s, err := sidecar.Read(archiveDir, strings.TrimSuffix(f.Name(), sidecar.Suffix))
+		if err != nil {
+			continue
+		}
+		if f.Name() == s.Filename+sidecar.Suffix {
+			// the plain name comes first, so the numbering of the others stays the same on import
+			sidecars[s.Filename] = append([]string{f.Name()}, sidecars[s.Filename]...)
+		} else {
+			sidecars[s.Filename] = append(sidecars[s.Filename], f.Name())
+		}
+	}
+
+	return sidecars
+}
+
+func addFile(w writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return w.add(name, info.Size(), f)
+}
+
+// manifestToCsv renders all items as csv with a header line
+func manifestToCsv(items []db.Item) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write([]string{"guid", "timestamp", "filename", "size", "mime_type", "sha256"})
+	for _, i := range items {
+		w.Write([]string{i.Guid, strconv.FormatInt(i.Timestamp, 10), i.Filename, strconv.FormatInt(i.Size, 10), i.MimeType, i.Sha256})
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+// walk calls fn for every file in the bundle
+func walk(bundlePath string, fn func(name string, r io.Reader) error) error {
+	format, err := Format(bundlePath)
+	if err != nil {
+		return err
+	}
+
+	if format == "zip" {
+		z, err := zip.OpenReader(bundlePath)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			r, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(f.Name, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = fn(h.Name, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	// Imported is the number of items added to the archive
+	Imported int
+	// Duplicates is the number of items whose guid is already archived
+	Duplicates int
+	// Renamed is the number of imported files that got a new name because theirs was already taken
+	Renamed int
+	// Missing is the number of items whose media is not part of the bundle
+	Missing int
+	// Invalid is the number of items whose filename is not a plain name, like ../archive.json
+	Invalid int
+	// Collections is the number of collections of the bundle merged into those of the archive by name
+	Collections int
+}
+
+// validFilename tells whether the filename of a bundled item names a file right inside the archive directory
+func validFilename(name string) bool {
+	return name != "" && name != "." && name != ".." && name == filepath.Base(name) && name == path.Base(name) && !strings.Contains(name, `\`)
+}
+
+// Import merges the bundle into the archive in archiveDir. Items whose guid is already archived are skipped,
+// as are items whose filename would point outside the archive directory. If a filename is already taken, the
+// imported file is renamed. Items of the bundle sharing a file keep sharing it. Collections are merged by name
+// and list the items of the bundle that are archived afterwards
+func Import(bundlePath, archiveDir string) (ImportResult, error) {
+	var r ImportResult
+	var manifest db.Data
+	err := walk(bundlePath, func(name string, rd io.Reader) error {
+		if name != manifestJson {
+			return nil
+		}
+		return json.NewDecoder(rd).Decode(&manifest)
+	})
+	if err != nil {
+		return r, err
+	}
+
+	a := db.NewArchive(filepath.Join(archiveDir, "archive.json"))
+	a.Read()
+	err = os.MkdirAll(archiveDir, 0755)
+	if err != nil {
+		return r, err
+	}
+
+	// decide on the items to import and their local filenames before extracting anything
+	var imports []db.Item
+	guids := map[string]bool{}
+	for _, i := range manifest.Items {
+		if !validFilename(i.Filename) {
+			r.Invalid++
+			continue
+		}
+		if a.Contains(i.Guid) || guids[i.Guid] {
+			r.Duplicates++
+			continue
+		}
+		imports = append(imports, i)
+		guids[i.Guid] = true
+	}
+
+	// original filename in the bundle to local filename
+	originals := map[string]string{}
+	reserved := map[string]bool{}
+	for _, i := range imports {
+		if _, ok := originals[i.Filename]; ok {
+			continue
+		}
+		name := db.FreeFilename(archiveDir, i.Filename, reserved)
+		if name != i.Filename {
+			r.Renamed++
+		}
+		reserved[name] = true
+		originals[i.Filename] = name
+	}
+
+	err = walk(bundlePath, func(name string, rd io.Reader) error {
+		switch {
+		case strings.HasPrefix(name, mediaDir):
+			local, ok := originals[path.Base(name)]
+			if !ok {
+				return nil
+			}
+			return extract(rd, filepath.Join(archiveDir, local))
+		case strings.HasPrefix(name, metaDir):
+			var s sidecar.Sidecar
+			err := json.NewDecoder(rd).Decode(&s)
+			if err != nil {
+				return err
+			}
+			// sidecars are matched by their content, as those of items sharing a file are numbered
+			local, ok := originals[s.Filename]
+			if !ok || !guids[s.Guid] {
+				return nil
+			}
+			s.Filename = local
+			return sidecar.Write(archiveDir, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return r, err
+	}
+
+	for _, item := range imports {
+		item.Filename, item.Thumbnail = originals[item.Filename], ""
+		if _, err := os.Stat(filepath.Join(archiveDir, item.Filename)); err != nil {
+			// media missing in the bundle
+			r.Missing++
+			continue
+		}
+		a.AddItem(item)
+		r.Imported++
+	}
+
+	for _, c := range manifest.Collections {
+		var archived []string
+		for _, g := range c.Guids {
+			if a.Contains(g) {
+				archived = append(archived, g)
+			}
+		}
+		_, err := a.AddToCollection(c.Name, archived...)
+		if err != nil {
+			// a name no collection can be found by
+			continue
+		}
+		if existing, _ := a.Collection(c.Name); existing.Description == "" && c.Description != "" {
+			a.DescribeCollection(c.Name, c.Description)
+		}
+		r.Collections++
+	}
+
+	return r, a.Persist()
+}
+
+func extract(r io.Reader, dst string) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package bundle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/sidecar"
+)
+
+func tempArchive(t *testing.T, dir string, files map[string]string) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal("Could not create temp dir. Error in test!", err)
+	}
+	a := db.NewArchive(filepath.Join(dir, "archive.json"))
+	n := int64(0)
+	for guid, filename := range files {
+		n++
+		ioutil.WriteFile(filepath.Join(dir, filename), []byte(guid), 0644)
+		a.Add(guid, n, filename)
+	}
+	a.Persist()
+}
+
+func testRoundTrip(t *testing.T, bundleName string) {
+	dir := filepath.Join(os.TempDir(), "souparchive-bundle-test")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	tempArchive(t, source, map[string]string{"1": "a.gif", "2": "b.gif"})
+	sidecar.Write(source, sidecar.Sidecar{Guid: "1", Filename: "a.gif", Link: "http://foo.soup.io/post/1"})
+	s := db.NewArchive(filepath.Join(source, "archive.json"))
+	s.Read()
+	// a repost sharing the file of guid 1 with a sidecar of its own, an item whose file is gone and one
+	// whose filename points outside the archive
+	s.Add("4", 4, "a.gif")
+	s.Add("5", 5, "c.gif")
+	s.Add("6", 6, "../b.gif")
+	s.AddToCollection("Best of", "4", "5", "6")
+	s.DescribeCollection("Best of", "only the best")
+	s.Persist()
+	sidecar.Write(source, sidecar.Sidecar{Guid: "4", Filename: "a.gif", Link: "http://foo.soup.io/post/4"})
+
+	target := filepath.Join(dir, "target")
+	tempArchive(t, target, map[string]string{"2": "b.gif", "3": "a.gif"})
+
+	bundlePath := filepath.Join(dir, bundleName)
+	missing, err := Export(source, bundlePath)
+	if err != nil {
+		t.Fatal("Expected bundle to be exported, got", err)
+	}
+	if len(missing) != 2 || missing[0] != "c.gif" || missing[1] != "../b.gif" {
+		t.Fatal("Expected missing c.gif and ../b.gif to be reported, got", missing)
+	}
+
+	r, err := Import(bundlePath, target)
+	if err != nil {
+		t.Fatal("Expected bundle to be imported, got", err)
+	}
+	if r != (ImportResult{Imported: 2, Duplicates: 1, Renamed: 1, Missing: 1, Invalid: 1, Collections: 1}) {
+		t.Fatalf("Expected 2 imported, 1 duplicate, 1 renamed, 1 missing and 1 invalid item and 1 collection, got %+v", r)
+	}
+
+	a := db.NewArchive(filepath.Join(target, "archive.json"))
+	a.Read()
+	if len(a.Data.Items) != 4 {
+		t.Fatal("Expected 4 items in target archive, got", len(a.Data.Items))
+	}
+	for _, imp := range a.Data.Items[2:] {
+		if (imp.Guid != "1" && imp.Guid != "4") || imp.Filename != "a-1.gif" {
+			t.Fatalf("Expected guids 1 and 4 to be imported sharing a-1.gif, got %s as %s", imp.Guid, imp.Filename)
+		}
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(target, "a-1.gif"))
+	if string(data) != "1" {
+		t.Fatal("Expected content of imported file, got", string(data))
+	}
+	sc, err := sidecar.Read(target, "a-1.gif")
+	if err != nil || sc.Link != "http://foo.soup.io/post/1" || sc.Filename != "a-1.gif" {
+		t.Fatal("Expected sidecar to be imported with the new filename, got", sc, err)
+	}
+	sc, err = sidecar.Read(target, "a-1.gif-1")
+	if err != nil || sc.Guid != "4" || sc.Filename != "a-1.gif" {
+		t.Fatal("Expected the sidecar of the repost to be imported as well, got", sc, err)
+	}
+	c, ok := a.Collection("Best of")
+	if !ok || c.Description != "only the best" || len(c.Guids) != 1 || c.Guids[0] != "4" {
+		t.Fatal("Expected the collection to be imported with its archived items, got", c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "source", "archive.json")); err != nil {
+		t.Fatal("Expected source archive to be untouched")
+	}
+}
+
+func TestZipRoundTrip(t *testing.T) {
+	testRoundTrip(t, "bundle.zip")
+}
+
+func TestTarGzRoundTrip(t *testing.T) {
+	testRoundTrip(t, "bundle.tar.gz")
+}
+
+func TestManifestCsv(t *testing.T) {
+	csv := manifestToCsv([]db.Item{{Guid: "1", Timestamp: 100, Filename: "a,b.gif", Size: 3}})
+	expected := "guid,timestamp,filename,size,mime_type,sha256\n1,100,\"a,b.gif\",3,,\n"
+	if csv != expected {
+		t.Fatalf("Expected csv %q, got %q", expected, csv)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := Format("bundle.rar"); err == nil {
+		t.Fatal("Expected error on unknown format, got nil")
+	}
+}
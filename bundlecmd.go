@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bestform/souparchive/bundle"
+)
+
+// exportBundle writes the archive into a zip or tar.gz bundle
+func exportBundle(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	out := fs.String("out", "souparchive.zip", "bundle to write. The format is chosen by the extension: .zip, .tar.gz or .tgz")
+	fs.Parse(args)
+
+	missing, err := bundle.Export(*dir, *out)
+	for _, m := range missing {
+		fmt.Println("Skipped missing file", m)
+	}
+	if err != nil {
+		fmt.Println("Error exporting bundle:", err)
+		return 1
+	}
+	fmt.Printf("Exported archive to %s\n", *out)
+
+	return 0
+}
+
+// importBundle merges a bundle into the archive
+func importBundle(args []string) int {
+	fs := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory to import into")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: import-bundle [-archive dir] bundle\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	r, err := bundle.Import(fs.Arg(0), *dir)
+	if err != nil {
+		fmt.Println("Error importing bundle:", err)
+		return 1
+	}
+	fmt.Printf("Imported %d items, skipped %d items already in the archive, %d items without media and %d items with invalid filenames, renamed %d files, merged %d collections\n", r.Imported, r.Duplicates, r.Missing, r.Invalid, r.Renamed, r.Collections)
+
+	return 0
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Config contains everything needed to set up the http client used for fetching feeds and media
+type Config struct {
+	ConnectTimeout Duration `json:"connect_timeout"`
+	ReadTimeout    Duration `json:"read_timeout"`
+	TotalTimeout   Duration `json:"total_timeout"`
+	UserAgent      string   `json:"user_agent"`
+	Proxy          string   `json:"proxy"`
+	CABundle       string   `json:"ca_bundle"`
+}
+
+// DefaultConfig returns the configuration used if nothing else is specified
+func DefaultConfig() Config {
+	return Config{
+		ConnectTimeout: Duration{10 * time.Second},
+		ReadTimeout:    Duration{30 * time.Second},
+		TotalTimeout:   Duration{10 * time.Minute},
+		UserAgent:      "souparchive",
+	}
+}
+
+// Duration wraps time.Duration to be able to read values like "10s" from json
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON will parse the duration format known from time.ParseDuration
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v string
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*d = Duration{parsed}
+
+	return nil
+}
+
+// MarshalJSON writes the duration in the same format UnmarshalJSON is able to read
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Client is an http client that sends the configured User-Agent with every request
+type Client struct {
+	http      *http.Client
+	userAgent string
+}
+
+// New creates a Client based on the given configuration
+func New(c Config) (*Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   c.ConnectTimeout.Duration,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   c.ConnectTimeout.Duration,
+		ResponseHeaderTimeout: c.ReadTimeout.Duration,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	if c.Proxy != "" {
+		proxyUrl, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid proxy %s: %s", c.Proxy, err))
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errors.New(fmt.Sprintf("Unsupported proxy scheme %s", proxyUrl.Scheme))
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if c.CABundle != "" {
+		pem, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error reading CA bundle %s: %s", c.CABundle, err))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("No certificates found in CA bundle %s", c.CABundle))
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &Client{
+		http:      &http.Client{Transport: transport, Timeout: c.TotalTimeout.Duration},
+		userAgent: c.UserAgent,
+	}, nil
+}
+
+// Get issues a GET request to the given url. The request is aborted when ctx is cancelled
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	return c.Do(ctx, "GET", url)
+}
+
+// Do issues a request with the given method to the given url. The request is aborted when ctx is cancelled
+func (c *Client) Do(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	return c.http.Do(req)
+}
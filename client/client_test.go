@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserAgentIsSent(t *testing.T) {
+	var userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+
+	c := DefaultConfig()
+	c.UserAgent = "testagent"
+	client, err := New(c)
+	if err != nil {
+		t.Fatal("Expected client to be created, but got", err)
+	}
+	resp, err := client.Get(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal("Expected request to succeed, but got", err)
+	}
+	resp.Body.Close()
+
+	if userAgent != "testagent" {
+		t.Fatalf("Expected User-Agent to be 'testagent', got '%s'", userAgent)
+	}
+}
+
+func TestTotalTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c := DefaultConfig()
+	c.TotalTimeout = Duration{10 * time.Millisecond}
+	client, err := New(c)
+	if err != nil {
+		t.Fatal("Expected client to be created, but got", err)
+	}
+	_, err = client.Get(context.Background(), ts.URL)
+	if err == nil {
+		t.Fatal("Expected timeout error, but got nil")
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal("Expected client to be created, but got", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Get(ctx, ts.URL)
+	if err == nil {
+		t.Fatal("Expected error on cancelled context, but got nil")
+	}
+}
+
+func TestErrorOnUnsupportedProxy(t *testing.T) {
+	c := DefaultConfig()
+	c.Proxy = "ftp://localhost:21"
+	_, err := New(c)
+	if err == nil {
+		t.Fatal("Expected error on unsupported proxy scheme, but got nil")
+	}
+
+	c.Proxy = "socks5://localhost:1080"
+	_, err = New(c)
+	if err != nil {
+		t.Fatal("Expected socks5 proxy to be accepted, but got", err)
+	}
+}
+
+func TestErrorOnMissingCABundle(t *testing.T) {
+	c := DefaultConfig()
+	c.CABundle = "fixtures/does-not-exist.pem"
+	_, err := New(c)
+	if err == nil {
+		t.Fatal("Expected error on missing CA bundle, but got nil")
+	}
+}
+
+func TestUnmarshalConfig(t *testing.T) {
+	var c Config
+	err := json.Unmarshal([]byte(`{"connect_timeout":"5s","total_timeout":"2m","user_agent":"foo"}`), &c)
+	if err != nil {
+		t.Fatal("Expected config to be parsed, but got", err)
+	}
+	if c.ConnectTimeout.Duration != 5*time.Second {
+		t.Fatalf("Expected connect timeout of 5s, got %v", c.ConnectTimeout)
+	}
+	if c.TotalTimeout.Duration != 2*time.Minute {
+		t.Fatalf("Expected total timeout of 2m, got %v", c.TotalTimeout)
+	}
+	if c.UserAgent != "foo" {
+		t.Fatalf("Expected user agent 'foo', got '%s'", c.UserAgent)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// collection adds the selected items to a named collection or removes them from it. Without a selection it lists the
+// items of the collection, without a name all collections
+func collection(args []string) int {
+	fs := flag.NewFlagSet("collection", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	remove := fs.Bool("remove", false, "remove the selected items from the collection instead of adding them")
+	del := fs.Bool("delete", false, "delete the collection. Its items stay in the archive")
+	description := fs.String("description", "", "set the description of the collection")
+	sel := registerSelectionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: collection [-archive dir] [-remove | -delete] [-description text] [-guid guid]... [-q text] [-from date] [-to date] [name]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	a := db.NewArchive(filepath.Join(*dir, "archive.json"))
+	a.Read()
+
+	if fs.NArg() == 0 {
+		for _, c := range a.Data.Collections {
+			fmt.Printf("%s (%d)\n", c.Name, len(c.Guids))
+		}
+		return 0
+	}
+	name := fs.Arg(0)
+
+	switch {
+	case *del:
+		if !a.DeleteCollection(name) {
+			fmt.Println("No collection named", name)
+			return 1
+		}
+		fmt.Println("Deleted collection", name)
+	case sel.empty() && *description == "":
+		c, ok := a.Collection(name)
+		if !ok {
+			fmt.Println("No collection named", name)
+			return 1
+		}
+		for _, g := range c.Guids {
+			fmt.Println(g)
+		}
+		return 0
+	default:
+		var guids []string
+		if !sel.empty() {
+			var err error
+			guids, err = sel.match(a.Data.Items)
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+		}
+		if *remove {
+			fmt.Printf("Removed %d items from %s\n", a.RemoveFromCollection(name, guids...), name)
+		} else {
+			added, err := a.AddToCollection(name, guids...)
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+			fmt.Printf("Added %d items to %s\n", added, name)
+		}
+		if *description != "" {
+			a.DescribeCollection(name, *description)
+		}
+	}
+
+	err := a.Persist()
+	if err != nil {
+		fmt.Println("Error persisting archive:", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of souparchive. It gets all arguments following its name and returns the exit code
+type command struct {
+	run   func(args []string) int
+	usage string
+}
+
+// commands maps the names of all subcommands to their implementation
+var commands = map[string]command{
+	"annotate":      {annotate, "mark items as favorites, rate them or attach notes"},
+	"collection":    {collection, "add items to a named collection, remove them or list collections"},
+	"dupes":         {dupes, "list clusters of near identical images in the archive"},
+	"export":        {exportBundle, "write the archive into a zip or tar.gz bundle with manifest"},
+	"export-site":   {exportSite, "render the archive as static html site"},
+	"import-bundle": {importBundle, "merge a bundle into the archive"},
+	"merge":         {mergeArchives, "combine several archive directories into one"},
+	"reindex":       {reindex, "rebuild archive.json from the sidecar files in the archive"},
+	"stats":         {showStats, "summarize the archive by type, month, source domain and repost source"},
+	"tag":           {tag, "add tags to or remove them from items, or list all tags"},
+}
+
+// usage prints the flags of the archiver followed by all subcommands
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n    \t%s\n", name, commands[name].usage)
+	}
+}
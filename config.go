@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/bestform/souparchive/client"
+	"github.com/bestform/souparchive/host"
+)
+
+// config is the structure of the optional configuration file given via -config
+type config struct {
+	Client client.Config `json:"client"`
+	Host   host.Config   `json:"host"`
+}
+
+// defaultConfig is used for everything not set in a configuration file or via flags
+func defaultConfig() config {
+	return config{Client: client.DefaultConfig(), Host: host.DefaultConfig()}
+}
+
+// readConfig reads the configuration file at the given path. Values missing in the file keep their defaults,
+// except for the directory of the self signed certificate, which is kept next to the configuration file
+func readConfig(path string) (config, error) {
+	c := defaultConfig()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	c.Host.TLS.Dir = ""
+	err = json.Unmarshal(data, &c)
+	if c.Host.TLS.Dir == "" {
+		c.Host.TLS.Dir = filepath.Join(filepath.Dir(path), "tls")
+	}
+
+	return c, err
+}
+
+// clientFlags holds the flags that override the client section of the configuration
+type clientFlags struct {
+	connectTimeout *time.Duration
+	readTimeout    *time.Duration
+	totalTimeout   *time.Duration
+	userAgent      *string
+	proxy          *string
+	caBundle       *string
+}
+
+// registerClientFlags defines all flags concerning the http client with the defaults of the given configuration
+func registerClientFlags(c client.Config) clientFlags {
+	return clientFlags{
+		connectTimeout: flag.Duration("connect-timeout", c.ConnectTimeout.Duration, "timeout for establishing a connection"),
+		readTimeout:    flag.Duration("read-timeout", c.ReadTimeout.Duration, "timeout for waiting on a response after sending a request"),
+		totalTimeout:   flag.Duration("timeout", c.TotalTimeout.Duration, "timeout for a whole request including reading the body"),
+		userAgent:      flag.String("user-agent", c.UserAgent, "User-Agent header sent with every request"),
+		proxy:          flag.String("proxy", c.Proxy, "http, https or socks5 proxy url"),
+		caBundle:       flag.String("ca-bundle", c.CABundle, "PEM file with additional trusted certificate authorities"),
+	}
+}
+
+// apply overrides the values in the given configuration with every flag that has explicitly been set
+func (f clientFlags) apply(c *client.Config) {
+	flag.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "connect-timeout":
+			c.ConnectTimeout = client.Duration{Duration: *f.connectTimeout}
+		case "read-timeout":
+			c.ReadTimeout = client.Duration{Duration: *f.readTimeout}
+		case "timeout":
+			c.TotalTimeout = client.Duration{Duration: *f.totalTimeout}
+		case "user-agent":
+			c.UserAgent = *f.userAgent
+		case "proxy":
+			c.Proxy = *f.proxy
+		case "ca-bundle":
+			c.CABundle = *f.caBundle
+		}
+	})
+}
+
+// hostFlags holds the flags that override the address the archive is hosted on
+type hostFlags struct {
+	listen *string
+	port   *string
+}
+
+// registerHostFlags defines the flags concerning the host server
+func registerHostFlags() hostFlags {
+	return hostFlags{
+		listen: flag.String("listen", "", "address to host the archive on, e.g. 127.0.0.1 or 127.0.0.1:8080. Defaults to all interfaces"),
+		port:   flag.String("port", "", "port to host the archive on. Defaults to 8080"),
+	}
+}
+
+// apply overrides the listen address in the given configuration with the flags that have explicitly been set
+func (f hostFlags) apply(c *host.Config) {
+	address, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		address, port = c.Listen, ""
+	}
+	flag.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "listen":
+			if a, p, err := net.SplitHostPort(*f.listen); err == nil {
+				address = a
+				if !isSet("port") {
+					port = p
+				}
+			} else {
+				address = *f.listen
+			}
+		case "port":
+			port = *f.port
+		}
+	})
+	c.Listen = net.JoinHostPort(address, port)
+}
+
+// isSet tells whether the flag with the given name has explicitly been set
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigKeepsCertificateNextToIt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "souparchive.json")
+	ioutil.WriteFile(path, []byte(`{"host": {"listen": ":8443", "tls": {"self_signed": true}}}`), 0644)
+
+	c, err := readConfig(path)
+	if err != nil {
+		t.Fatal("Expected config to be read, got", err)
+	}
+	if c.Host.TLS.Dir != filepath.Join(dir, "tls") || c.Host.Listen != ":8443" || c.Host.Templates != "host/templates" {
+		t.Fatalf("Expected certificate next to the config and defaults for the rest, got %+v", c.Host)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"host": {"tls": {"dir": "/etc/souparchive/tls"}}}`), 0644)
+	c, _ = readConfig(path)
+	if c.Host.TLS.Dir != "/etc/souparchive/tls" {
+		t.Fatal("Expected configured directory to be kept, got", c.Host.TLS.Dir)
+	}
+}
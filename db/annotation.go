@@ -0,0 +1,62 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxRating is the best rating an item can get
+const MaxRating = 5
+
+// Annotation changes the annotations of an item. Only the fields that are set are changed
+type Annotation struct {
+	Favorite *bool   `json:"favorite,omitempty"`
+	Note     *string `json:"note,omitempty"`
+	Rating   *int    `json:"rating,omitempty"`
+}
+
+// Validate checks the values of the annotation
+func (an Annotation) Validate() error {
+	if an.Rating != nil && (*an.Rating < 0 || *an.Rating > MaxRating) {
+		return errors.New(fmt.Sprintf("Invalid rating %d, must be between 0 and %d", *an.Rating, MaxRating))
+	}
+
+	return nil
+}
+
+// Annotate applies the annotation to the item with the given guid. It returns false if there is no such item
+func (a *Archive) Annotate(guid string, an Annotation) (bool, error) {
+	err := an.Validate()
+	if err != nil {
+		return false, err
+	}
+	n := a.item(guid)
+	if n < 0 {
+		return false, nil
+	}
+
+	if an.Favorite != nil {
+		a.Data.Items[n].Favorite = *an.Favorite
+	}
+	if an.Note != nil {
+		a.Data.Items[n].Note = strings.TrimSpace(*an.Note)
+	}
+	if an.Rating != nil {
+		a.Data.Items[n].Rating = *an.Rating
+	}
+
+	return true, nil
+}
+
+// Favorites returns all favorite items
+func Favorites(items []Item) []Item {
+	var result []Item
+	for _, i := range items {
+		if i.Favorite {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	a := NewArchive("")
+	a.Add("1", 100, "a.gif")
+	a.Add("2", 200, "b.gif")
+
+	favorite, note, rating := true, "  posted by a friend ", 4
+	ok, err := a.Annotate("1", Annotation{Favorite: &favorite, Note: &note, Rating: &rating})
+	if !ok || err != nil {
+		t.Fatal("Expected item to be annotated, got", ok, err)
+	}
+	if i := a.Data.Items[0]; !i.Favorite || i.Note != "posted by a friend" || i.Rating != 4 {
+		t.Fatalf("Expected annotations to be set, got %+v", i)
+	}
+
+	favorite = false
+	a.Annotate("1", Annotation{Favorite: &favorite})
+	if i := a.Data.Items[0]; i.Favorite || i.Note != "posted by a friend" || i.Rating != 4 {
+		t.Fatalf("Expected only favorite to change, got %+v", i)
+	}
+
+	rating = MaxRating + 1
+	if _, err := a.Annotate("1", Annotation{Rating: &rating}); err == nil {
+		t.Fatal("Expected invalid rating to be rejected")
+	}
+	if ok, _ := a.Annotate("3", Annotation{Favorite: &favorite}); ok {
+		t.Fatal("Expected unknown guid not to be annotated")
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	items := []Item{{Guid: "1", Favorite: true}, {Guid: "2"}, {Guid: "3", Favorite: true}}
+	if f := Favorites(items); len(f) != 2 || f[1].Guid != "3" {
+		t.Fatal("Expected 2 favorites, got", f)
+	}
+}
@@ -1,10 +1,15 @@
 package db
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // Archive represents the location and the data of a given archive
@@ -15,13 +20,36 @@ type Archive struct {
 
 // Data is just a list of guids that have already been processed for a given feed
 type Data struct {
-	Items []Item `json:"items"`
+	Items       []Item       `json:"items"`
+	Collections []Collection `json:"collections,omitempty"`
 }
 
+// Item is one archived entry of the feed
 type Item struct {
 	Guid      string `json:"guid"`
+	Account   string `json:"account,omitempty"`
 	Timestamp int64  `json:"timestamp"`
 	Filename  string `json:"filename"`
+	Size      int64  `json:"size,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+	Sha256    string `json:"sha256,omitempty"`
+	// SourceUrl is where the media has been downloaded from, Link the post in the feed. For reposts it points to the original post
+	SourceUrl string `json:"source_url,omitempty"`
+	Link      string `json:"link,omitempty"`
+	// Embed is the original embed code of archived videos
+	Embed string `json:"embed,omitempty"`
+	// Snapshot is the name of the self-contained copy of the page a link post points to inside the archive
+	Snapshot string `json:"snapshot,omitempty"`
+	// PHash is the hex encoded perceptual hash of images, used to find reposts in other sizes or qualities
+	PHash string `json:"phash,omitempty"`
+	// Thumbnail is the name of the preview inside the thumbs directory of the archive, if one has been generated
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Tags are user defined, normalized with Slug and sorted
+	Tags []string `json:"tags,omitempty"`
+	// Favorite, Note and Rating are annotations by the users of the archive. A Rating of 0 means unrated
+	Favorite bool   `json:"favorite,omitempty"`
+	Note     string `json:"note,omitempty"`
+	Rating   int    `json:"rating,omitempty"`
 }
 
 // NewArchive will create a new Archive struct with the given path
@@ -58,12 +86,18 @@ func (a *Archive) Contains(guid string) bool {
 
 // Add will add the guid to the archive. Keep in mind that this is only in memory until Persist() is called
 func (a *Archive) Add(guid string, timestamp int64, filename string) error {
-	a.Data.Items = append(a.Data.Items, Item{guid, timestamp, filename})
+	return a.AddItem(Item{Guid: guid, Timestamp: timestamp, Filename: filename})
+}
+
+// AddItem will add the given item to the archive. Keep in mind that this is only in memory until Persist() is called
+func (a *Archive) AddItem(i Item) error {
+	a.Data.Items = append(a.Data.Items, i)
 
 	return nil
 }
 
-// Persist will write the current data to the disk at the given path
+// Persist will write the current data to the disk at the given path.
+// The data is written to a temporary file first, so an interrupted write never leaves a broken archive behind
 func (a *Archive) Persist() error {
 	path := filepath.Dir(a.Path)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -77,7 +111,42 @@ func (a *Archive) Persist() error {
 	if err != nil {
 		return err
 	}
-	ioutil.WriteFile(a.Path, data, 0600)
+	tmp := a.Path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return os.Rename(tmp, a.Path)
+}
+
+// FileChecksum returns the size and the hex encoded sha256 checksum of the file at the given path
+func FileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FreeFilename returns a name based on the given one that is neither taken in dir nor in the given set
+// of reserved names by appending a counter if needed. reserved may be nil
+func FreeFilename(dir, name string, reserved map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 1; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, candidate)); os.IsNotExist(err) && !reserved[candidate] {
+			return candidate
+		}
+		candidate = base + "-" + strconv.Itoa(n) + ext
+	}
 }
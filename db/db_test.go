@@ -87,3 +87,41 @@ func TestArchiveContains(t *testing.T) {
 	}
 
 }
+
+func TestPersistLeavesNoTemporaryFile(t *testing.T) {
+	tempdir := os.TempDir()
+
+	a := NewArchive(filepath.Join(tempdir, "archive.json"))
+	a.Add("foo", 100, "filename1")
+
+	err := a.Persist()
+	if err != nil {
+		t.Fatal("Expected archive to be persisted, but got", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempdir, "archive.json.tmp")); !os.IsNotExist(err) {
+		t.Fatal("Expected temporary file to be renamed, but it still exists")
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	size, checksum, err := FileChecksum("fixtures/archive.json")
+	if err != nil {
+		t.Fatal("Expected checksum to be computed, got", err)
+	}
+	if size == 0 || len(checksum) != 64 {
+		t.Fatalf("Expected size and sha256 checksum, got %d and '%s'", size, checksum)
+	}
+}
+
+func TestFreeFilename(t *testing.T) {
+	if name := FreeFilename("fixtures", "foo.json", nil); name != "foo.json" {
+		t.Fatal("Expected free name to stay unchanged, got", name)
+	}
+	if name := FreeFilename("fixtures", "archive.json", nil); name != "archive-1.json" {
+		t.Fatal("Expected counter to be appended to taken name, got", name)
+	}
+	if name := FreeFilename("fixtures", "archive.json", map[string]bool{"archive-1.json": true}); name != "archive-2.json" {
+		t.Fatal("Expected reserved names to be skipped, got", name)
+	}
+}
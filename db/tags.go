@@ -0,0 +1,225 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Collection is a named selection of items, referenced by guid in the order they were added
+type Collection struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Guids       []string `json:"guids"`
+}
+
+// Slug turns a tag or collection name into its canonical form: lower case letters and digits separated by dashes.
+// Slugs are safe to use in urls and filenames
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	return b.String()
+}
+
+// HasTag tells whether the item is tagged with the given tag
+func (i Item) HasTag(tag string) bool {
+	tag = Slug(tag)
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// item returns the index of the item with the given guid or -1
+func (a *Archive) item(guid string) int {
+	for n, i := range a.Data.Items {
+		if i.Guid == guid {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// SetTags replaces the tags of the item with the given guid. It returns false if there is no such item
+func (a *Archive) SetTags(guid string, tags []string) bool {
+	n := a.item(guid)
+	if n < 0 {
+		return false
+	}
+
+	set := map[string]bool{}
+	for _, t := range tags {
+		if t = Slug(t); t != "" {
+			set[t] = true
+		}
+	}
+	a.Data.Items[n].Tags = nil
+	for t := range set {
+		a.Data.Items[n].Tags = append(a.Data.Items[n].Tags, t)
+	}
+	sort.Strings(a.Data.Items[n].Tags)
+
+	return true
+}
+
+// Tag adds the given tags to the item with the given guid. It returns false if there is no such item
+func (a *Archive) Tag(guid string, tags ...string) bool {
+	n := a.item(guid)
+	if n < 0 {
+		return false
+	}
+
+	return a.SetTags(guid, append(append([]string{}, a.Data.Items[n].Tags...), tags...))
+}
+
+// Untag removes the given tags from the item with the given guid. It returns false if there is no such item
+func (a *Archive) Untag(guid string, tags ...string) bool {
+	n := a.item(guid)
+	if n < 0 {
+		return false
+	}
+
+	var kept []string
+	for _, t := range a.Data.Items[n].Tags {
+		removed := false
+		for _, r := range tags {
+			removed = removed || t == Slug(r)
+		}
+		if !removed {
+			kept = append(kept, t)
+		}
+	}
+
+	return a.SetTags(guid, kept)
+}
+
+// Tags counts the items of every tag used in the archive
+func (a *Archive) Tags() map[string]int {
+	return CountTags(a.Data.Items)
+}
+
+// CountTags counts the items of every tag used in the given items
+func CountTags(items []Item) map[string]int {
+	counts := map[string]int{}
+	for _, i := range items {
+		for _, t := range i.Tags {
+			counts[t]++
+		}
+	}
+
+	return counts
+}
+
+// collection returns the index of the collection with the given name or -1. Names are compared by their Slug
+func (a *Archive) collection(name string) int {
+	for n, c := range a.Data.Collections {
+		if Slug(c.Name) == Slug(name) {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// Collection returns the collection with the given name
+func (a *Archive) Collection(name string) (Collection, bool) {
+	n := a.collection(name)
+	if n < 0 {
+		return Collection{}, false
+	}
+
+	return a.Data.Collections[n], true
+}
+
+// AddToCollection adds the items with the given guids to the named collection, which is created if needed.
+// Guids already in the collection are skipped. It returns the number of added guids. Names without a single
+// letter or digit are rejected, as the collection could not be found by its slug
+func (a *Archive) AddToCollection(name string, guids ...string) (int, error) {
+	if Slug(name) == "" {
+		return 0, errors.New(fmt.Sprintf("Invalid collection name %q, it needs at least one letter or digit", name))
+	}
+	n := a.collection(name)
+	if n < 0 {
+		a.Data.Collections = append(a.Data.Collections, Collection{Name: name, Guids: []string{}})
+		n = len(a.Data.Collections) - 1
+	}
+
+	added := 0
+	for _, g := range guids {
+		if !contains(a.Data.Collections[n].Guids, g) {
+			a.Data.Collections[n].Guids = append(a.Data.Collections[n].Guids, g)
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+// DescribeCollection sets the description of the named collection. It returns false if there is no such collection
+func (a *Archive) DescribeCollection(name, description string) bool {
+	n := a.collection(name)
+	if n < 0 {
+		return false
+	}
+	a.Data.Collections[n].Description = description
+
+	return true
+}
+
+// RemoveFromCollection removes the items with the given guids from the named collection. It returns the number of removed guids
+func (a *Archive) RemoveFromCollection(name string, guids ...string) int {
+	n := a.collection(name)
+	if n < 0 {
+		return 0
+	}
+
+	var kept []string
+	for _, g := range a.Data.Collections[n].Guids {
+		if !contains(guids, g) {
+			kept = append(kept, g)
+		}
+	}
+	removed := len(a.Data.Collections[n].Guids) - len(kept)
+	a.Data.Collections[n].Guids = append([]string{}, kept...)
+
+	return removed
+}
+
+// DeleteCollection removes the named collection. The items stay in the archive. It returns false if there is no such collection
+func (a *Archive) DeleteCollection(name string) bool {
+	n := a.collection(name)
+	if n < 0 {
+		return false
+	}
+	a.Data.Collections = append(a.Data.Collections[:n], a.Data.Collections[n+1:]...)
+
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
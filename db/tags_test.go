@@ -0,0 +1,81 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Cats":           "cats",
+		"  best of 2016": "best-of-2016",
+		"a/b\\c":         "a-b-c",
+		"Ärger!":         "ärger",
+		"--":             "",
+	}
+	for name, expected := range tests {
+		if s := Slug(name); s != expected {
+			t.Fatalf("Expected slug %q for %q, got %q", expected, name, s)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	a := NewArchive("")
+	a.Add("1", 100, "a.gif")
+	a.Add("2", 200, "b.gif")
+
+	if !a.Tag("1", "Cats", "funny", "cats") || !a.Tag("2", "cats") {
+		t.Fatal("Expected items to be tagged")
+	}
+	if a.Tag("3", "cats") {
+		t.Fatal("Expected unknown guid not to be tagged")
+	}
+	if strings.Join(a.Data.Items[0].Tags, ",") != "cats,funny" {
+		t.Fatal("Expected normalized, unique and sorted tags, got", a.Data.Items[0].Tags)
+	}
+	if counts := a.Tags(); counts["cats"] != 2 || counts["funny"] != 1 {
+		t.Fatal("Expected tag counts, got", counts)
+	}
+
+	a.Untag("1", "CATS")
+	if a.Data.Items[0].HasTag("cats") || !a.Data.Items[0].HasTag("Funny") {
+		t.Fatal("Expected cats to be removed, got", a.Data.Items[0].Tags)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-collections-test")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	a := NewArchive(filepath.Join(dir, "archive.json"))
+	a.Add("1", 100, "a.gif")
+	a.Add("2", 200, "b.gif")
+	if added, err := a.AddToCollection("Best of 2017", "2", "1", "2"); added != 2 || err != nil {
+		t.Fatal("Expected 2 guids to be added, got", added, err)
+	}
+	if _, err := a.AddToCollection("!!!", "1"); err == nil || len(a.Data.Collections) != 1 {
+		t.Fatal("Expected a name without letters or digits to be rejected, got", err)
+	}
+	a.Persist()
+
+	b := NewArchive(a.Path)
+	b.Read()
+	c, ok := b.Collection("best-of-2017")
+	if !ok || c.Name != "Best of 2017" || strings.Join(c.Guids, ",") != "2,1" {
+		t.Fatal("Expected collection to be found by slug with guids in order, got", c)
+	}
+
+	if removed := b.RemoveFromCollection("Best of 2017", "2"); removed != 1 {
+		t.Fatal("Expected 1 guid to be removed, got", removed)
+	}
+	if !b.DeleteCollection("best of 2017") {
+		t.Fatal("Expected collection to be deleted")
+	}
+	if _, ok := b.Collection("Best of 2017"); ok {
+		t.Fatal("Expected deleted collection to be gone")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bestform/souparchive/fetch"
+	"github.com/bestform/souparchive/stats"
+)
+
+// printPlan writes the plan of a dry run either human readable or as json
+func printPlan(w io.Writer, p fetch.Plan, asJson bool) error {
+	if asJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	}
+
+	for _, i := range p.Items {
+		switch i.Action {
+		case fetch.ActionDownload:
+			fmt.Fprintf(w, "download  %s (%s)\n", i.Url, stats.FormatBytes(i.Bytes))
+		case fetch.ActionArchived:
+			fmt.Fprintf(w, "archived  %s\n", i.Url)
+		case fetch.ActionSkip:
+			fmt.Fprintf(w, "skip      %s %s: %s\n", i.Guid, i.Url, i.Reason)
+		}
+	}
+	fmt.Fprintf(w, "\n%d to download (%s), %d already archived, %d skipped\n", p.Download, stats.FormatBytes(p.Bytes), p.Archived, p.Skipped)
+
+	return nil
+}
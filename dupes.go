@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/phash"
+)
+
+// dupes lists clusters of near identical images. Missing perceptual hashes are computed and stored first
+func dupes(args []string) int {
+	fs := flag.NewFlagSet("dupes", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	threshold := fs.Int("threshold", phash.DefaultThreshold, "maximum number of differing bits of perceptual hashes")
+	fs.Parse(args)
+
+	a := db.NewArchive(filepath.Join(*dir, "archive.json"))
+	a.Read()
+
+	updated := 0
+	for n, i := range a.Data.Items {
+		if i.PHash != "" {
+			continue
+		}
+		hash, err := phash.File(filepath.Join(*dir, i.Filename))
+		if err != nil {
+			// not an image
+			continue
+		}
+		a.Data.Items[n].PHash = phash.Format(hash)
+		updated++
+	}
+	if updated > 0 {
+		err := a.Persist()
+		if err != nil {
+			fmt.Println("Error persisting archive:", err)
+			return 1
+		}
+	}
+
+	clusters := phash.Clusters(a.Data.Items, *threshold)
+	for n, c := range clusters {
+		fmt.Printf("Cluster %d:\n", n+1)
+		for _, i := range c {
+			fmt.Printf("  %s  %s\n", i.Filename, i.Guid)
+		}
+	}
+	fmt.Printf("%d clusters of near duplicates\n", len(clusters))
+
+	return 0
+}
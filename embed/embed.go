@@ -0,0 +1,97 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Metadata describes the origin of an archived file
+type Metadata struct {
+	SourceUrl string
+	Link      string
+	Caption   string
+	Published time.Time
+}
+
+// File writes the metadata into the JPEG or PNG at the given path without re-encoding the image data.
+// Other files are left untouched. In any case the modification time of the file is set to the publish date
+func File(path string, m Metadata) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		out, err = JPEG(data, m)
+	case bytes.HasPrefix(data, pngSignature):
+		out, err = PNG(data, m)
+	}
+	if err != nil {
+		return err
+	}
+
+	if out != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		tmp := path + ".tmp"
+		err = ioutil.WriteFile(tmp, out, info.Mode())
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmp, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Published.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(path, m.Published, m.Published)
+}
+
+// xmpNamespace starts every XMP segment in a JPEG and is the keyword of the XMP chunk in a PNG
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+
+// xmpPacket renders the metadata as XMP
+func xmpPacket(m Metadata) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\" xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\">\n")
+	if m.SourceUrl != "" {
+		b.WriteString("   <dc:source>")
+		xml.EscapeText(&b, []byte(m.SourceUrl))
+		b.WriteString("</dc:source>\n")
+	}
+	if m.Link != "" {
+		b.WriteString("   <dc:relation><rdf:Bag><rdf:li>")
+		xml.EscapeText(&b, []byte(m.Link))
+		b.WriteString("</rdf:li></rdf:Bag></dc:relation>\n")
+	}
+	if m.Caption != "" {
+		b.WriteString("   <dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+		xml.EscapeText(&b, []byte(m.Caption))
+		b.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if !m.Published.IsZero() {
+		date := m.Published.UTC().Format(time.RFC3339)
+		b.WriteString("   <xmp:CreateDate>" + date + "</xmp:CreateDate>\n")
+		b.WriteString("   <photoshop:DateCreated>" + date + "</photoshop:DateCreated>\n")
+	}
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+
+	return b.Bytes()
+}
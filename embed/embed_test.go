@@ -0,0 +1,104 @@
+package embed
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testMetadata = Metadata{
+	SourceUrl: "http://example.com/a.jpg",
+	Link:      "http://foo.soup.io/post/1",
+	Caption:   "cats & dogs",
+	Published: time.Date(2017, time.February, 23, 14, 14, 29, 0, time.UTC),
+}
+
+func testImage(t *testing.T, format string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	var b bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&b, img, nil)
+	} else {
+		err = png.Encode(&b, img)
+	}
+	if err != nil {
+		t.Fatal("Could not encode image. Error in test!", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestJPEG(t *testing.T) {
+	data := testImage(t, "jpeg")
+	out, err := JPEG(data, testMetadata)
+	if err != nil {
+		t.Fatal("Expected metadata to be embedded, got", err)
+	}
+
+	if _, _, err := image.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatal("Expected result to be a valid JPEG, got", err)
+	}
+	for _, expected := range []string{"Exif\x00\x00", xmpNamespace, "cats &amp; dogs", "http://foo.soup.io/post/1", "2017:02:23 14:14:29"} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Fatalf("Expected result to contain %q", expected)
+		}
+	}
+
+	// embedding twice replaces the XMP instead of adding another one
+	again, err := JPEG(out, testMetadata)
+	if err != nil {
+		t.Fatal("Expected metadata to be embedded again, got", err)
+	}
+	if len(again) != len(out) {
+		t.Fatalf("Expected same size after embedding twice, got %d and %d", len(out), len(again))
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data := testImage(t, "png")
+	out, err := PNG(data, testMetadata)
+	if err != nil {
+		t.Fatal("Expected metadata to be embedded, got", err)
+	}
+
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatal("Expected result to be a valid PNG, got", err)
+	}
+	for _, expected := range []string{"iTXtXML:com.adobe.xmp", "eXIf", "cats &amp; dogs", "Creation Time"} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Fatalf("Expected result to contain %q", expected)
+		}
+	}
+	if bytes.Index(out, []byte("iTXt")) > bytes.Index(out, []byte("IDAT")) {
+		t.Fatal("Expected metadata in front of the image data")
+	}
+}
+
+func TestFileSetsModificationTime(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-embed-test")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.gif")
+	ioutil.WriteFile(path, []byte("GIF89a"), 0644)
+
+	err := File(path, testMetadata)
+	if err != nil {
+		t.Fatal("Expected unsupported files to be left alone, got", err)
+	}
+	info, _ := os.Stat(path)
+	if !info.ModTime().Equal(testMetadata.Published) {
+		t.Fatal("Expected modification time to be the publish date, got", info.ModTime())
+	}
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "GIF89a" {
+		t.Fatal("Expected gif to be unchanged")
+	}
+}
@@ -0,0 +1,113 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// exif tags written by this package
+const (
+	tagImageDescription = 0x010e
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+	tagUserComment      = 0x9286
+)
+
+// exif field types used by this package
+const (
+	typeAscii     = 2
+	typeLong      = 4
+	typeUndefined = 7
+)
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifData renders the metadata as a big endian TIFF structure as used in JPEG APP1 segments and PNG eXIf chunks.
+// IFD0 holds the caption and date, the Exif IFD the original date and the source urls as user comment
+func exifData(m Metadata) []byte {
+	var ifd0, exifIFD []ifdEntry
+	if m.Caption != "" {
+		ifd0 = append(ifd0, asciiEntry(tagImageDescription, m.Caption))
+	}
+	if !m.Published.IsZero() {
+		date := m.Published.UTC().Format("2006:01:02 15:04:05")
+		ifd0 = append(ifd0, asciiEntry(tagDateTime, date))
+		exifIFD = append(exifIFD, asciiEntry(tagDateTimeOriginal, date))
+	}
+	comment := ""
+	if m.SourceUrl != "" {
+		comment += "Source: " + m.SourceUrl
+	}
+	if m.Link != "" {
+		if comment != "" {
+			comment += "\n"
+		}
+		comment += "Post: " + m.Link
+	}
+	if comment != "" {
+		value := append([]byte("ASCII\x00\x00\x00"), comment...)
+		exifIFD = append(exifIFD, ifdEntry{tagUserComment, typeUndefined, uint32(len(value)), value})
+	}
+
+	// the header takes 8 bytes, IFD0 follows directly, the Exif IFD after IFD0 and its data
+	ifd0 = append(ifd0, ifdEntry{tagExifIFD, typeLong, 1, make([]byte, 4)})
+	exifOffset := 8 + ifdSize(ifd0)
+	binary.BigEndian.PutUint32(ifd0[len(ifd0)-1].value, exifOffset)
+
+	var b bytes.Buffer
+	b.WriteString("MM\x00\x2a\x00\x00\x00\x08")
+	writeIFD(&b, ifd0, 8)
+	writeIFD(&b, exifIFD, exifOffset)
+
+	return b.Bytes()
+}
+
+func asciiEntry(tag uint16, v string) ifdEntry {
+	value := append([]byte(v), 0)
+	return ifdEntry{tag, typeAscii, uint32(len(value)), value}
+}
+
+// ifdSize is the number of bytes the IFD and its out of line values take
+func ifdSize(entries []ifdEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += uint32(len(e.value) + len(e.value)%2)
+		}
+	}
+
+	return size
+}
+
+// writeIFD writes the IFD starting at the given offset relative to the TIFF header. Values longer than four bytes follow the IFD
+func writeIFD(b *bytes.Buffer, entries []ifdEntry, offset uint32) {
+	binary.Write(b, binary.BigEndian, uint16(len(entries)))
+	dataOffset := offset + uint32(2+12*len(entries)+4)
+	var data bytes.Buffer
+	for _, e := range entries {
+		binary.Write(b, binary.BigEndian, e.tag)
+		binary.Write(b, binary.BigEndian, e.typ)
+		binary.Write(b, binary.BigEndian, e.count)
+		if len(e.value) <= 4 {
+			v := make([]byte, 4)
+			copy(v, e.value)
+			b.Write(v)
+			continue
+		}
+		binary.Write(b, binary.BigEndian, dataOffset+uint32(data.Len()))
+		data.Write(e.value)
+		if len(e.value)%2 == 1 {
+			// values start on word boundaries
+			data.WriteByte(0)
+		}
+	}
+	// no further IFD
+	b.Write([]byte{0, 0, 0, 0})
+	b.Write(data.Bytes())
+}
@@ -0,0 +1,97 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var jpegSOI = []byte{0xff, 0xd8}
+
+const (
+	markerAPP0 = 0xe0
+	markerAPP1 = 0xe1
+	markerSOS  = 0xda
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// JPEG adds an XMP segment with the metadata to the JPEG, replacing any existing XMP. An Exif segment is only
+// added if the image does not already carry one. Everything from the start of the scan on is copied unchanged
+func JPEG(data []byte, m Metadata) ([]byte, error) {
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return nil, errors.New("Not a JPEG")
+	}
+
+	var leading, rest [][]byte
+	hasExif := false
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return nil, errors.New(fmt.Sprintf("Invalid JPEG segment at offset %d", pos))
+		}
+		marker := data[pos+1]
+		if marker == markerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New(fmt.Sprintf("Invalid JPEG segment length at offset %d", pos))
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+		pos = end
+
+		if marker == markerAPP1 && bytes.HasPrefix(payload, []byte(xmpNamespace+"\x00")) {
+			// replaced by our own
+			continue
+		}
+		if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			hasExif = true
+		}
+		if marker == markerAPP0 && len(rest) == 0 {
+			// JFIF and JFXX segments have to stay in front
+			leading = append(leading, segment)
+			continue
+		}
+		rest = append(rest, segment)
+	}
+
+	xmp, err := app1(append([]byte(xmpNamespace+"\x00"), xmpPacket(m)...))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(jpegSOI)
+	for _, s := range leading {
+		b.Write(s)
+	}
+	if !hasExif {
+		exif, err := app1(append(exifHeader, exifData(m)...))
+		if err != nil {
+			return nil, err
+		}
+		b.Write(exif)
+	}
+	b.Write(xmp)
+	for _, s := range rest {
+		b.Write(s)
+	}
+	b.Write(data[pos:])
+
+	return b.Bytes(), nil
+}
+
+// app1 wraps the payload into an APP1 segment
+func app1(payload []byte) ([]byte, error) {
+	if len(payload)+2 > 0xffff {
+		return nil, errors.New("Metadata too large for a JPEG segment")
+	}
+	segment := []byte{0xff, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	return append(segment, payload...), nil
+}
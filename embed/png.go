@@ -0,0 +1,77 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PNG adds the metadata as XMP iTXt chunk, eXIf chunk and Creation Time tEXt chunk in front of the image data.
+// Existing XMP is replaced, an existing eXIf chunk is kept. All other chunks are copied unchanged
+func PNG(data []byte, m Metadata) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("Not a PNG")
+	}
+
+	var b bytes.Buffer
+	b.Write(pngSignature)
+
+	hasExif := false
+	inserted := false
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, errors.New(fmt.Sprintf("Invalid PNG chunk at offset %d", pos))
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errors.New(fmt.Sprintf("Invalid PNG chunk length at offset %d", pos))
+		}
+		typ := string(data[pos+4 : pos+8])
+		chunkData := data[pos+8 : pos+8+length]
+		chunk := data[pos:end]
+		pos = end
+
+		if typ == "iTXt" && bytes.HasPrefix(chunkData, []byte("XML:com.adobe.xmp\x00")) {
+			continue
+		}
+		if typ == "eXIf" {
+			hasExif = true
+		}
+		if (typ == "IDAT" || typ == "IEND") && !inserted {
+			writeMetadataChunks(&b, m, hasExif)
+			inserted = true
+		}
+		b.Write(chunk)
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeMetadataChunks(b *bytes.Buffer, m Metadata, hasExif bool) {
+	// keyword, no compression, no language tag, no translated keyword
+	itxt := append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmpPacket(m)...)
+	writeChunk(b, "iTXt", itxt)
+	if !hasExif {
+		writeChunk(b, "eXIf", exifData(m))
+	}
+	if !m.Published.IsZero() {
+		writeChunk(b, "tEXt", []byte("Creation Time\x00"+m.Published.UTC().Format(time.RFC1123)))
+	}
+}
+
+func writeChunk(b *bytes.Buffer, typ string, data []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	b.WriteString(typ)
+	b.Write(data)
+	binary.Write(b, binary.BigEndian, crc.Sum32())
+}
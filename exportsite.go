@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bestform/souparchive/host"
+)
+
+// exportSite renders the archive as a static html site
+func exportSite(args []string) int {
+	fs := flag.NewFlagSet("export-site", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	out := fs.String("out", "site", "directory the site is written to")
+	templates := fs.String("templates", host.DefaultConfig().Templates, "directory containing the templates of the site")
+	fs.Parse(args)
+
+	missing, err := host.Export(*dir, *out, *templates)
+	for _, m := range missing {
+		fmt.Println("Skipped missing file", m)
+	}
+	if err != nil {
+		fmt.Println("Error exporting site:", err)
+		return 1
+	}
+	fmt.Printf("Exported site to %s\n", *out)
+
+	return 0
+}
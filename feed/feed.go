@@ -22,11 +22,13 @@ type Channel struct {
 
 // Item is one entry in the feed
 type Item struct {
-	Enclosure  Enclosure  `xml:"enclosure"`
-	Link       string     `xml:"link"`
-	Guid       string     `xml:"guid"`
-	PubDate    PubDate    `xml:"pubDate"`
-	Attributes Attributes `xml:"attributes"`
+	Title       string     `xml:"title"`
+	Description string     `xml:"description"`
+	Enclosure   Enclosure  `xml:"enclosure"`
+	Link        string     `xml:"link"`
+	Guid        string     `xml:"guid"`
+	PubDate     PubDate    `xml:"pubDate"`
+	Attributes  Attributes `xml:"attributes"`
 }
 
 // Enclosure contains the url and type of the item
@@ -39,6 +41,10 @@ type Enclosure struct {
 type Attributes struct {
 	Type string `json:"type"`
 	Url  string `json:"url"`
+	// Embed is the embed code or the url of the video of video posts
+	Embed string `json:"embedcode_or_url,omitempty"`
+	// Source is the page a link post points to
+	Source string `json:"source,omitempty"`
 }
 
 // UnmarshalXML will parse the enclosed json and produce an Attributes element
@@ -14,6 +14,7 @@ func TestUnmarshallingXml(t *testing.T) {
     <link>Testlink</link>
     <description>Testdescription</description>
     <item>
+      <title>Item1Title</title>
       <enclosure url="enc1Url" type="enc1Type" />
        <soup:attributes>
 	 {"type":"attrType1","url":"attrUrl1"}
@@ -48,6 +49,7 @@ func TestUnmarshallingXml(t *testing.T) {
 	if err != nil {
 		t.Fatal("Could not load location for time comparison. Error in test!", err)
 	}
+	check(result.Channel.Items[0].Title, "Item1Title", t)
 	check(result.Channel.Items[0].Guid, "Item1GUID", t)
 	check(result.Channel.Items[0].Link, "Item1Link", t)
 	checkTime(result.Channel.Items[0].PubDate, time.Date(2017, time.February, 23, 14, 14, 29, 0, loc), t)
@@ -1,46 +1,69 @@
 package fetch
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path"
+	"sync"
 
 	"errors"
 
+	"github.com/bestform/souparchive/client"
 	"github.com/bestform/souparchive/db"
 	"github.com/bestform/souparchive/feed"
 )
 
 // response is a thin wrapper around http.Response. It is used to mock actual responses in tests
 type response struct {
-	StatusCode int
-	Body       io.ReadCloser
+	StatusCode    int
+	ContentLength int64
+	ContentType   string
+	Body          io.ReadCloser
 }
 
 // httpClient abstracts the needed interface from the http package to be able to mock it in tests
 type httpClient interface {
-	Get(string) (*response, error)
+	Get(context.Context, string) (*response, error)
+	Head(context.Context, string) (*response, error)
 }
 
-// defaultHttpClient wraps the corresponding methods from the http package
-type defaultHttpClient struct{}
+// defaultHttpClient wraps the corresponding methods from the configured client
+type defaultHttpClient struct {
+	client *client.Client
+}
 
-// Get wraps http.Get and produces a response as defined privately in this package
-func (d *defaultHttpClient) Get(url string) (*response, error) {
-	resp, err := http.Get(url)
+// Get wraps client.Get and produces a response as defined privately in this package
+func (d *defaultHttpClient) Get(ctx context.Context, url string) (*response, error) {
+	resp, err := d.client.Get(ctx, url)
 	if err != nil {
 		return &response{}, err
 	}
 
-	return &response{StatusCode: resp.StatusCode, Body: resp.Body}, nil
+	return &response{StatusCode: resp.StatusCode, ContentLength: resp.ContentLength, ContentType: resp.Header.Get("Content-Type"), Body: resp.Body}, nil
+}
+
+// Head issues a HEAD request via the client and produces a response as defined privately in this package
+func (d *defaultHttpClient) Head(ctx context.Context, url string) (*response, error) {
+	resp, err := d.client.Do(ctx, "HEAD", url)
+	if err != nil {
+		return &response{}, err
+	}
+	resp.Body.Close()
+
+	return &response{StatusCode: resp.StatusCode, ContentLength: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
 }
 
 // osLayer abstracts the needed interface from the io and os packages to be able to mock them in tests
 type osLayer interface {
 	Create(string) (io.ReadWriteCloser, error)
 	Copy(io.Writer, io.Reader) (int64, error)
+	Remove(string) error
 }
 
 // defaultOsLayer wraps the corresponding methods from the io and os packages
@@ -56,39 +79,139 @@ func (d *defaultOsLayer) Copy(w io.Writer, r io.Reader) (int64, error) {
 	return io.Copy(w, r)
 }
 
+// Remove wraps os.Remove
+func (d *defaultOsLayer) Remove(filename string) error {
+	return os.Remove(filename)
+}
+
 // default setup for live code. Tests will substitute those vars with mocks
 var osl osLayer = &defaultOsLayer{}
-var httpc httpClient = &defaultHttpClient{}
+var httpc httpClient = newDefaultHttpClient()
+
+// newDefaultHttpClient sets up a client with the default configuration
+func newDefaultHttpClient() httpClient {
+	c, err := client.New(client.DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	return &defaultHttpClient{c}
+}
+
+// UseClient makes Fetch download all media through the given client
+func UseClient(c *client.Client) {
+	httpc = &defaultHttpClient{c}
+}
+
+// Source returns the url an item is archived from. For video posts this is the url of the video, for link posts
+// the linked page if snapshots are enabled
+func Source(i feed.Item) string {
+	if e, ok := FindEmbed(i); ok {
+		return e.Url
+	}
+	if link := Link(i); link != "" && snapshots {
+		return link
+	}
+
+	return i.Attributes.Url
+}
 
-// Fetch tries to download the item contained in the given feed.Items, if it isn't already in the archive
-func Fetch(i feed.Item, a db.Archive) (string, int64, string, error) {
+// Fetch tries to download the item contained in the given feed.Items, if it isn't already in the archive.
+// Videos embedded in video posts are archived as described for FindEmbed, the pages of link posts as snapshots if enabled.
+// If ctx is cancelled during the download, the partially written file is removed again.
+// On success it returns the db.Item describing the archived file
+func Fetch(ctx context.Context, i feed.Item, a db.Archive) (db.Item, error) {
+	source := Source(i)
 	if a.Contains(i.Guid) {
 		// already in archive
-		return "", 0, "", errors.New(i.Attributes.Url + " already in archive")
+		return db.Item{}, errors.New(source + " already in archive")
 	}
+	if ctx.Err() != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Skipping %s: %s", source, ctx.Err()))
+	}
+
+	var item db.Item
+	var err error
+	if e, ok := FindEmbed(i); ok {
+		item, err = fetchVideo(ctx, e)
+		item.Embed = e.Code
+	} else if link := Link(i); link != "" && snapshots {
+		item, err = fetchSnapshot(ctx, link)
+		item.Snapshot = item.Filename
+	} else {
+		item, err = download(ctx, source, i.Enclosure.Type)
+	}
+	if err != nil {
+		return db.Item{}, err
+	}
+	item.Guid, item.Timestamp, item.SourceUrl, item.Link = i.Guid, i.PubDate.Unix(), source, i.Link
+
+	return item, nil
+}
+
+// reserved holds the names handed out by freeFilename until their files exist, so concurrent downloads never share a file
+var reserved = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// freeFilename returns a name based on the given one that is neither taken in the archive nor by another download.
+// A repost of an already archived file is saved next to it instead of overwriting it
+func freeFilename(name string) string {
+	reserved.Lock()
+	defer reserved.Unlock()
+	name = db.FreeFilename("archive", name, reserved.names)
+	reserved.names[name] = true
+
+	return name
+}
+
+// release gives up the reservation of a name handed out by freeFilename once its file is written or removed
+func release(name string) {
+	reserved.Lock()
+	defer reserved.Unlock()
+	delete(reserved.names, name)
+}
 
-	response, err := httpc.Get(i.Attributes.Url)
+// download saves the file at the given url in the archive. enclosureType is the media type announced in the feed, if any.
+// The returned db.Item only describes the file
+func download(ctx context.Context, url string, enclosureType string) (db.Item, error) {
+	response, err := httpc.Get(ctx, url)
 	if err != nil {
-		return "", 0, "", errors.New(fmt.Sprintf("Error fetching %s: %s", i.Attributes.Url, err))
+		return db.Item{}, errors.New(fmt.Sprintf("Error fetching %s: %s", url, err))
 	}
 	if response.StatusCode != http.StatusOK {
-		return "", 0, "", errors.New(fmt.Sprintf("Error fetching %s: Status %d", i.Attributes.Url, response.StatusCode))
+		response.Body.Close()
+		return db.Item{}, errors.New(fmt.Sprintf("Error fetching %s: Status %d", url, response.StatusCode))
 	}
 
-	filepath := "archive/" + path.Base(i.Attributes.Url)
+	// peek at the beginning of the download to find out what it actually is
+	body := bufio.NewReaderSize(response.Body, 512)
+	head, _ := body.Peek(512)
+	mimeType := mediaType(sniff(head), response.ContentType, enclosureType)
+
+	name := freeFilename(filenameFor(url, mimeType))
+	defer release(name)
+	filepath := "archive/" + name
 	file, err := osl.Create(filepath)
 	if err != nil {
-		return "", 0, "", errors.New(fmt.Sprintf("Error opening file %s: %s", filepath, err))
+		response.Body.Close()
+		return db.Item{}, errors.New(fmt.Sprintf("Error opening file %s: %s", filepath, err))
 	}
 
-	_, err = osl.Copy(file, response.Body)
+	checksum := sha256.New()
+	size, err := osl.Copy(file, io.TeeReader(body, checksum))
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		response.Body.Close()
 		file.Close()
-		return "", 0, "", errors.New(fmt.Sprintf("Error writing file %s: %s", filepath, err))
+		osl.Remove(filepath)
+		return db.Item{}, errors.New(fmt.Sprintf("Error writing file %s: %s", filepath, err))
 	}
 	response.Body.Close()
 	file.Close()
 
-	return i.Guid, i.PubDate.Unix(), path.Base(filepath), nil
+	return db.Item{Filename: path.Base(filepath), Size: size, MimeType: mimeType, Sha256: hex.EncodeToString(checksum.Sum(nil))}, nil
 }
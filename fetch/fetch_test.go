@@ -1,7 +1,10 @@
 package fetch
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"net/http"
@@ -28,7 +31,9 @@ func (t testFile) Close() error {
 
 type testOsLayer struct {
 	created         string
+	removed         string
 	copyCalledTimes int
+	copyError       error
 }
 
 func (d *testOsLayer) Create(filename string) (io.ReadWriteCloser, error) {
@@ -37,37 +42,54 @@ func (d *testOsLayer) Create(filename string) (io.ReadWriteCloser, error) {
 }
 func (d *testOsLayer) Copy(w io.Writer, r io.Reader) (int64, error) {
 	d.copyCalledTimes++
-	return 0, nil
+	return 0, d.copyError
+}
+func (d *testOsLayer) Remove(filename string) error {
+	d.removed = filename
+	return nil
 }
 
 type testHttpClient struct {
 	askedForUrl string
+	headForUrl  string
 	getError    error
 	response    response
 }
 
-func (d *testHttpClient) Get(url string) (*response, error) {
+func (d *testHttpClient) Get(ctx context.Context, url string) (*response, error) {
 	d.askedForUrl = url
+	if d.response.Body == nil {
+		// like net/http, a response always has a body
+		d.response.Body = &testBody{}
+	}
 	return &d.response, d.getError
 }
 
-type testBody struct{}
+func (d *testHttpClient) Head(ctx context.Context, url string) (*response, error) {
+	d.headForUrl = url
+	return &d.response, d.getError
+}
+
+type testBody struct {
+	closed bool
+}
 
 func (t *testBody) Read(p []byte) (n int, err error) {
 	return 0, nil
 }
 
 func (t *testBody) Close() error {
+	t.closed = true
 	return nil
 }
 
 func TestReturnOnItemAlreadyInArchive(t *testing.T) {
 	a := db.Archive{}
-	a.Data.Items = append(a.Data.Items, db.Item{"foo", 0, "testfile"})
+	a.Data.Items = append(a.Data.Items, db.Item{Guid: "foo", Filename: "testfile"})
 	i := feed.Item{}
 	i.Guid = "foo"
 
-	_, _, _, err := Fetch(i, a)
+	_, err := Fetch(context.Background(), i, a)
 	if err == nil {
 		t.Fatal("Expected error on item already in archive, but got none")
 	}
@@ -82,7 +104,7 @@ func TestFetchOfCorrectUrl(t *testing.T) {
 	i.Guid = "foo"
 	i.Attributes.Url = "testURL"
 
-	Fetch(i, a)
+	Fetch(context.Background(), i, a)
 	if mockHttpClient.askedForUrl != "testURL" {
 		t.Fatalf("Expected http get on %s but got %s", "testURL", mockHttpClient.askedForUrl)
 	}
@@ -96,7 +118,7 @@ func TestErrorOnGetError(t *testing.T) {
 	a := db.Archive{}
 	i := feed.Item{}
 
-	_, _, _, err := Fetch(i, a)
+	_, err := Fetch(context.Background(), i, a)
 	if err == nil {
 		t.Fatal("Expected error on http get error, but got nil")
 	}
@@ -107,14 +129,19 @@ func TestErrorOnBadHttpStatus(t *testing.T) {
 	osl = &testOsLayer{}
 	mockHttpClient := &testHttpClient{}
 	mockHttpClient.response.StatusCode = http.StatusBadGateway
+	body := &testBody{}
+	mockHttpClient.response.Body = body
 	httpc = mockHttpClient
 	a := db.Archive{}
 	i := feed.Item{}
 
-	_, _, _, err := Fetch(i, a)
+	_, err := Fetch(context.Background(), i, a)
 	if err == nil {
 		t.Fatal("Expected error on bad http status, but got nil")
 	}
+	if !body.closed {
+		t.Fatal("Expected body of the failed response to be closed")
+	}
 }
 
 func TestCreateCorrectFile(t *testing.T) {
@@ -128,7 +155,7 @@ func TestCreateCorrectFile(t *testing.T) {
 	i := feed.Item{}
 	i.Attributes.Url = "foo/bar/baz"
 
-	Fetch(i, a)
+	Fetch(context.Background(), i, a)
 	if mockOsLayer.created != "archive/baz" {
 		t.Fatalf("Expected file created to be %s, but got %s", "archive/baz", mockOsLayer.created)
 	}
@@ -145,7 +172,7 @@ func TestCopyFromResponse(t *testing.T) {
 	i := feed.Item{}
 	i.Enclosure.Url = "foo/bar/baz"
 
-	Fetch(i, a)
+	Fetch(context.Background(), i, a)
 	if mockOsLayer.copyCalledTimes != 1 {
 		t.Fatal("Expected data to be copied one time but got", mockOsLayer.copyCalledTimes)
 	}
@@ -164,20 +191,84 @@ func TestReturnOfGuidAndFilenameOnSuccessfulCopy(t *testing.T) {
 	i.PubDate = feed.PubDate{time.Unix(100, 0)}
 	i.Attributes.Url = "testurl"
 
-	guid, timestamp, filename, err := Fetch(i, a)
+	item, err := Fetch(context.Background(), i, a)
 	if err != nil {
 		t.Fatal("Expected return of guid without error but got", err)
 	}
 
-	if guid != "foo" {
-		t.Fatal("Expected returned guid to be 'foo', but got", guid)
+	if item.Guid != "foo" {
+		t.Fatal("Expected returned guid to be 'foo', but got", item.Guid)
+	}
+
+	if item.Timestamp != 100 {
+		t.Fatal("Expected timestamp to be 100, got", item.Timestamp)
+	}
+
+	if item.Filename != "testurl" {
+		t.Fatal("Expected filename to be 'testurl', got", item.Filename)
+	}
+}
+
+func TestNoFetchOnCancelledContext(t *testing.T) {
+	osl = &testOsLayer{}
+	mockHttpClient := &testHttpClient{}
+	httpc = mockHttpClient
+	a := db.Archive{}
+	i := feed.Item{}
+	i.Attributes.Url = "testURL"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Fetch(ctx, i, a)
+	if err == nil {
+		t.Fatal("Expected error on cancelled context, but got nil")
+	}
+	if mockHttpClient.askedForUrl != "" {
+		t.Fatal("Expected no http get on cancelled context, but got one for", mockHttpClient.askedForUrl)
 	}
+}
 
-	if timestamp != 100 {
-		t.Fatal("Expected timestamp to be 100, got", timestamp)
+func TestRemovePartialFileOnCopyError(t *testing.T) {
+	mockOsLayer := testOsLayer{}
+	mockOsLayer.copyError = errors.New("connection reset")
+	osl = &mockOsLayer
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusOK
+	mockHttpClient.response.Body = &testBody{}
+	httpc = mockHttpClient
+	a := db.Archive{}
+	i := feed.Item{}
+	i.Attributes.Url = "foo/bar/baz"
+
+	_, err := Fetch(context.Background(), i, a)
+	if err == nil {
+		t.Fatal("Expected error on copy error, but got nil")
+	}
+	if mockOsLayer.removed != "archive/baz" {
+		t.Fatalf("Expected partial file %s to be removed, but got '%s'", "archive/baz", mockOsLayer.removed)
 	}
+}
+
+func TestSniffedMediaType(t *testing.T) {
+	mockOsLayer := testOsLayer{}
+	osl = &mockOsLayer
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusOK
+	mockHttpClient.response.ContentType = "application/octet-stream"
+	mockHttpClient.response.Body = ioutil.NopCloser(strings.NewReader("GIF89a......"))
+	httpc = mockHttpClient
+	a := db.Archive{}
+	i := feed.Item{}
+	i.Attributes.Url = "http://example.com/asset/1234?download=1"
 
-	if filename != "testurl" {
-		t.Fatal("Expected filename to be 'testurl', got", filename)
+	item, err := Fetch(context.Background(), i, a)
+	if err != nil {
+		t.Fatal("Expected successful fetch, got", err)
+	}
+	if item.MimeType != "image/gif" {
+		t.Fatal("Expected mime type image/gif, got", item.MimeType)
+	}
+	if mockOsLayer.created != "archive/1234.gif" {
+		t.Fatal("Expected file archive/1234.gif to be created, got", mockOsLayer.created)
 	}
 }
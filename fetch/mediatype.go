@@ -0,0 +1,102 @@
+package fetch
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// extensions maps the media types found on soup to the extension used for archived files
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"image/svg+xml":   ".svg",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"audio/ogg":       ".ogg",
+	"application/pdf": ".pdf",
+	"text/html":       ".html",
+}
+
+// genericTypes say little about a download. text/xml is what svg images are sniffed as
+var genericTypes = map[string]bool{
+	"application/octet-stream": true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// mediaType decides on the media type of a download. The sniffed type is trusted most, followed by the
+// Content-Type header and the type announced in the feed. Generic types are only used if nothing else is known
+func mediaType(sniffed, header, enclosure string) string {
+	generic := ""
+	for _, candidate := range []string{sniffed, header, enclosure} {
+		t, _, err := mime.ParseMediaType(candidate)
+		if err != nil || t == "" {
+			continue
+		}
+		if genericTypes[t] {
+			if generic == "" {
+				generic = t
+			}
+			continue
+		}
+		return t
+	}
+
+	return generic
+}
+
+// sniff detects the media type of the first bytes of a download
+func sniff(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	return http.DetectContentType(data)
+}
+
+// filenameFor produces the name an item is archived as. It is based on the last path segment of the url,
+// ignoring query strings, and gets an extension matching the media type if its own does not fit
+func filenameFor(rawUrl, mediaType string) string {
+	name := ""
+	if u, err := url.Parse(rawUrl); err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = fmt.Sprintf("%x", sha1.Sum([]byte(rawUrl)))[:16]
+	}
+
+	if mediaType == "" || mediaType == "application/octet-stream" || mediaType == "text/plain" {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if ext != "" {
+		t, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+		if t == mediaType || extensions[mediaType] == strings.ToLower(ext) {
+			return name
+		}
+	}
+
+	want, ok := extensions[mediaType]
+	if !ok {
+		exts, _ := mime.ExtensionsByType(mediaType)
+		if len(exts) == 0 {
+			return name
+		}
+		want = exts[0]
+	}
+	if strings.EqualFold(ext, ".jpeg") && want == ".jpg" {
+		return name
+	}
+
+	return name + want
+}
@@ -0,0 +1,49 @@
+package fetch
+
+import "testing"
+
+func TestMediaTypePrefersSniffedType(t *testing.T) {
+	if m := mediaType("image/gif", "image/jpeg", "image/png"); m != "image/gif" {
+		t.Fatal("Expected sniffed type image/gif, got", m)
+	}
+	if m := mediaType("application/octet-stream", "image/jpeg; charset=binary", "image/png"); m != "image/jpeg" {
+		t.Fatal("Expected header type image/jpeg, got", m)
+	}
+	if m := mediaType("", "", "image/png"); m != "image/png" {
+		t.Fatal("Expected enclosure type image/png, got", m)
+	}
+	if m := mediaType("text/xml; charset=utf-8", "image/svg+xml", ""); m != "image/svg+xml" {
+		t.Fatal("Expected header type image/svg+xml for a sniffed svg, got", m)
+	}
+	if m := mediaType("application/octet-stream", "", ""); m != "application/octet-stream" {
+		t.Fatal("Expected generic type application/octet-stream, got", m)
+	}
+}
+
+func TestFilenameFor(t *testing.T) {
+	cases := []struct {
+		url, mediaType, expected string
+	}{
+		{"http://example.com/foo/bar.gif", "image/gif", "bar.gif"},
+		{"http://example.com/foo/bar.jpeg", "image/jpeg", "bar.jpeg"},
+		{"http://example.com/foo/bar.JPG", "image/jpeg", "bar.JPG"},
+		{"http://example.com/foo/bar.gif?width=100", "image/gif", "bar.gif"},
+		{"http://example.com/foo/bar", "image/png", "bar.png"},
+		{"http://example.com/foo/bar.jpg", "image/gif", "bar.jpg.gif"},
+		{"http://example.com/foo/bar", "", "bar"},
+		{"http://example.com/foo/bar", "application/octet-stream", "bar"},
+	}
+
+	for _, c := range cases {
+		if f := filenameFor(c.url, c.mediaType); f != c.expected {
+			t.Fatalf("Expected filename %s for %s (%s), got %s", c.expected, c.url, c.mediaType, f)
+		}
+	}
+}
+
+func TestFilenameForUrlWithoutPath(t *testing.T) {
+	f := filenameFor("http://example.com/", "image/png")
+	if len(f) != 20 {
+		t.Fatal("Expected hashed filename with extension, got", f)
+	}
+}
@@ -0,0 +1,105 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+// Action describes what a run would do with a single feed item
+type Action string
+
+const (
+	// ActionDownload means the item is not yet archived and would be fetched
+	ActionDownload Action = "download"
+	// ActionArchived means the item is already part of the archive
+	ActionArchived Action = "archived"
+	// ActionSkip means the item can not be archived. Reason contains the details
+	ActionSkip Action = "skip"
+)
+
+// PlannedItem is the outcome of planning a single feed item
+type PlannedItem struct {
+	Guid   string `json:"guid"`
+	Url    string `json:"url"`
+	Action Action `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Bytes is the size announced by the server, or -1 if it is unknown
+	Bytes int64 `json:"bytes"`
+}
+
+// Plan lists what a run would do with every item of a feed without writing anything
+type Plan struct {
+	Items    []PlannedItem `json:"items"`
+	Download int           `json:"download"`
+	Archived int           `json:"archived"`
+	Skipped  int           `json:"skipped"`
+	// Bytes is the sum of all known sizes of items that would be downloaded
+	Bytes int64 `json:"bytes"`
+}
+
+// NewPlan checks every item against the archive and asks the server for the size of every item that would be downloaded
+func NewPlan(ctx context.Context, items []feed.Item, a db.Archive) Plan {
+	p := Plan{}
+	for _, i := range items {
+		pi := planItem(ctx, i, a)
+		switch pi.Action {
+		case ActionDownload:
+			p.Download++
+			if pi.Bytes > 0 {
+				p.Bytes += pi.Bytes
+			}
+		case ActionArchived:
+			p.Archived++
+		case ActionSkip:
+			p.Skipped++
+		}
+		p.Items = append(p.Items, pi)
+	}
+
+	return p
+}
+
+func planItem(ctx context.Context, i feed.Item, a db.Archive) PlannedItem {
+	pi := PlannedItem{Guid: i.Guid, Url: Source(i), Bytes: -1}
+	if pi.Url == "" {
+		pi.Action = ActionSkip
+		pi.Reason = "no single url to save"
+		return pi
+	}
+	if a.Contains(i.Guid) {
+		pi.Action = ActionArchived
+		return pi
+	}
+
+	if e, ok := FindEmbed(i); ok && !e.Direct {
+		// the size is only known after the video downloader has run
+		if len(videoDownloader) == 0 {
+			pi.Action = ActionSkip
+			pi.Reason = "no video downloader configured"
+			return pi
+		}
+		pi.Action = ActionDownload
+		return pi
+	}
+
+	response, err := httpc.Head(ctx, pi.Url)
+	if err != nil {
+		pi.Action = ActionSkip
+		pi.Reason = fmt.Sprintf("HEAD request failed: %s", err)
+		return pi
+	}
+	if response.StatusCode != http.StatusOK {
+		pi.Action = ActionSkip
+		pi.Reason = fmt.Sprintf("HEAD request returned status %d", response.StatusCode)
+		return pi
+	}
+
+	pi.Action = ActionDownload
+	pi.Bytes = response.ContentLength
+
+	return pi
+}
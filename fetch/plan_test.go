@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+func TestPlan(t *testing.T) {
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusOK
+	mockHttpClient.response.ContentLength = 42
+	httpc = mockHttpClient
+
+	a := db.Archive{}
+	a.Add("archived", 100, "archived.jpg")
+
+	items := make([]feed.Item, 3)
+	items[0].Guid = "archived"
+	items[0].Attributes.Url = "http://example.com/archived.jpg"
+	items[1].Guid = "new"
+	items[1].Attributes.Url = "http://example.com/new.jpg"
+	items[2].Guid = "text"
+
+	p := NewPlan(context.Background(), items, a)
+
+	if p.Archived != 1 || p.Download != 1 || p.Skipped != 1 {
+		t.Fatalf("Expected 1 archived, 1 download and 1 skipped item, got %d, %d and %d", p.Archived, p.Download, p.Skipped)
+	}
+	if p.Items[0].Action != ActionArchived {
+		t.Fatal("Expected first item to be archived, got", p.Items[0].Action)
+	}
+	if p.Items[1].Action != ActionDownload {
+		t.Fatal("Expected second item to be downloaded, got", p.Items[1].Action)
+	}
+	if p.Items[2].Action != ActionSkip || p.Items[2].Reason == "" {
+		t.Fatal("Expected third item to be skipped with a reason, got", p.Items[2].Action)
+	}
+	if mockHttpClient.headForUrl != "http://example.com/new.jpg" {
+		t.Fatal("Expected HEAD request for new item only, got", mockHttpClient.headForUrl)
+	}
+	if p.Bytes != 42 {
+		t.Fatal("Expected 42 bytes to be downloaded, got", p.Bytes)
+	}
+}
+
+func TestPlanSkipsOnBadHeadStatus(t *testing.T) {
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusNotFound
+	httpc = mockHttpClient
+
+	items := make([]feed.Item, 1)
+	items[0].Guid = "gone"
+	items[0].Attributes.Url = "http://example.com/gone.jpg"
+
+	p := NewPlan(context.Background(), items, db.Archive{})
+	if p.Items[0].Action != ActionSkip {
+		t.Fatal("Expected item to be skipped, got", p.Items[0].Action)
+	}
+}
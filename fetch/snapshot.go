@@ -0,0 +1,90 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+	"github.com/bestform/souparchive/snapshot"
+)
+
+// snapshots is true if the pages link posts point to are archived
+var snapshots = false
+
+// UseSnapshots makes Fetch archive the pages link posts point to as self-contained html files
+func UseSnapshots(enabled bool) {
+	snapshots = enabled
+}
+
+// Link returns the url of the page a link post points to. It is empty for all other posts
+func Link(i feed.Item) string {
+	if i.Attributes.Type != "link" || i.Attributes.Url != "" {
+		return ""
+	}
+
+	return i.Attributes.Source
+}
+
+// snapshotGetter downloads the page and its resources for the snapshot package through httpc
+type snapshotGetter struct{}
+
+// Get downloads the resource at the given url unless it is larger than snapshot.MaxResourceSize
+func (g snapshotGetter) Get(ctx context.Context, url string) ([]byte, string, error) {
+	response, err := httpc.Get(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, "", errors.New(fmt.Sprintf("Status %d", response.StatusCode))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, snapshot.MaxResourceSize+1))
+
+	return data, response.ContentType, err
+}
+
+// fetchSnapshot saves a self-contained copy of the page at the given url in the archive. The returned db.Item only describes the file
+func fetchSnapshot(ctx context.Context, pageUrl string) (db.Item, error) {
+	page, err := snapshot.Page(ctx, snapshotGetter{}, pageUrl, time.Now())
+	if err != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Error taking snapshot of %s: %s", pageUrl, err))
+	}
+
+	// pages of the same site often share a name, e.g. index.html, so a free name is picked
+	name := freeFilename(snapshotName(pageUrl))
+	defer release(name)
+	filepath := "archive/" + name
+	file, err := osl.Create(filepath)
+	if err != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Error opening file %s: %s", filepath, err))
+	}
+	size, err := osl.Copy(file, bytes.NewReader(page))
+	file.Close()
+	if err != nil {
+		osl.Remove(filepath)
+		return db.Item{}, errors.New(fmt.Sprintf("Error writing file %s: %s", filepath, err))
+	}
+	checksum := sha256.Sum256(page)
+
+	return db.Item{Filename: name, Size: size, MimeType: "text/html", Sha256: hex.EncodeToString(checksum[:])}, nil
+}
+
+// snapshotName is the name a snapshot is archived as. It starts with the host, as many pages are called index.html or alike
+func snapshotName(pageUrl string) string {
+	name := filenameFor(pageUrl, "text/html")
+	if u, err := url.Parse(pageUrl); err == nil && u.Hostname() != "" {
+		name = u.Hostname() + "_" + name
+	}
+
+	return name
+}
@@ -0,0 +1,60 @@
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+func TestSnapshotOfLinkPost(t *testing.T) {
+	mockOsLayer := testOsLayer{}
+	osl = &mockOsLayer
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusOK
+	mockHttpClient.response.ContentType = "text/html"
+	mockHttpClient.response.Body = ioutil.NopCloser(strings.NewReader("<html><body>article</body></html>"))
+	httpc = mockHttpClient
+	i := feed.Item{Guid: "link", Link: "http://foo.soup.io/post/1"}
+	i.Attributes.Type = "link"
+	i.Attributes.Source = "http://example.com/blog/article"
+
+	if Source(i) != "" {
+		t.Fatal("Expected no source for link posts without snapshots, got", Source(i))
+	}
+
+	UseSnapshots(true)
+	defer UseSnapshots(false)
+	if Source(i) != "http://example.com/blog/article" {
+		t.Fatal("Expected the linked page as source, got", Source(i))
+	}
+	item, err := Fetch(context.Background(), i, db.Archive{})
+	if err != nil {
+		t.Fatal("Expected snapshot to be taken, got", err)
+	}
+	if mockOsLayer.created != "archive/example.com_article.html" {
+		t.Fatal("Expected file archive/example.com_article.html to be created, got", mockOsLayer.created)
+	}
+	if item.Snapshot != "example.com_article.html" || item.Filename != item.Snapshot || item.MimeType != "text/html" || item.SourceUrl != "http://example.com/blog/article" {
+		t.Fatalf("Expected item to describe the snapshot, got %+v", item)
+	}
+}
+
+func TestSnapshotNamesDoNotCollide(t *testing.T) {
+	first := freeFilename(snapshotName("http://example.com/blog/index.html"))
+	second := freeFilename(snapshotName("http://example.com/news/index.html"))
+	if first != "example.com_index.html" || second != "example.com_index-1.html" {
+		t.Fatal("Expected pages of the same name to be archived side by side, got", first, second)
+	}
+
+	release(first)
+	release(second)
+	if name := freeFilename(first); name != first {
+		t.Fatal("Expected released names to be free again, got", name)
+	}
+	release(first)
+}
@@ -0,0 +1,225 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+// Embed is the video of a soup video post
+type Embed struct {
+	// Url is the page of the video for known players, e.g. https://www.youtube.com/watch?v=..., otherwise the url found in the embed code
+	Url string
+	// Direct is true if Url points to a video file, like the ones hosted by soup, that can be downloaded as is
+	Direct bool
+	// Code is the original embed code
+	Code string
+}
+
+// videoExtensions are the extensions of video files that are downloaded directly
+var videoExtensions = map[string]bool{".mp4": true, ".webm": true, ".ogv": true, ".m4v": true, ".mov": true, ".flv": true}
+
+// embedUrl matches the urls in the attributes of embed code, e.g. the src of an iframe or the value of a param
+var embedUrl = regexp.MustCompile(`(?i)\b(?:src|data|value|href)\s*=\s*["']((?:https?:)?//[^"']+)["']`)
+
+// videoDownloader is the command used to archive videos that are not plain files. Nil if none is configured
+var videoDownloader []string
+
+// UseVideoDownloader makes Fetch archive videos from sites like YouTube or Vimeo with the given command, e.g. yt-dlp.
+// {url} in the arguments is replaced by the url of the video, otherwise the url is appended as last argument.
+// The command is run in an empty directory and the largest file it leaves there is archived
+func UseVideoDownloader(command []string) {
+	videoDownloader = command
+}
+
+// FindEmbed finds the video of posts without a media url. The embed code is taken from the attributes of the post
+// or its description. YouTube and Vimeo players as well as video files are recognized in any post, other urls only in video posts
+func FindEmbed(i feed.Item) (Embed, bool) {
+	if i.Attributes.Url != "" {
+		return Embed{}, false
+	}
+
+	for _, code := range []string{i.Attributes.Embed, i.Description} {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		candidates := []string{code}
+		if !strings.HasPrefix(code, "http://") && !strings.HasPrefix(code, "https://") {
+			candidates = nil
+			for _, m := range embedUrl.FindAllStringSubmatch(code, -1) {
+				candidates = append(candidates, html.UnescapeString(m[1]))
+			}
+		}
+
+		fallback := ""
+		for _, c := range candidates {
+			u, known := videoUrl(c)
+			if u == "" {
+				continue
+			}
+			if known {
+				return Embed{Url: u, Direct: isVideoFile(u), Code: code}, true
+			}
+			if fallback == "" {
+				fallback = u
+			}
+		}
+		if fallback != "" && i.Attributes.Type == "video" {
+			return Embed{Url: fallback, Code: code}, true
+		}
+	}
+
+	return Embed{}, false
+}
+
+// videoUrl resolves embedded players of known sites to the page of the video. known is true for these and for video files.
+// Urls that are neither http nor https are dropped
+func videoUrl(raw string) (u string, known bool) {
+	if strings.HasPrefix(raw, "//") {
+		raw = "https:" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	switch {
+	case host == "youtu.be" && segments[0] != "":
+		return "https://www.youtube.com/watch?v=" + segments[0], true
+	case host == "youtube.com" || host == "youtube-nocookie.com" || host == "m.youtube.com":
+		if len(segments) == 2 && (segments[0] == "embed" || segments[0] == "v") {
+			// old flash players append their options to the path, e.g. /v/abc123&hl=de
+			return "https://www.youtube.com/watch?v=" + strings.SplitN(segments[1], "&", 2)[0], true
+		}
+		if id := parsed.Query().Get("v"); segments[0] == "watch" && id != "" {
+			return "https://www.youtube.com/watch?v=" + id, true
+		}
+	case host == "player.vimeo.com" && len(segments) == 2 && segments[0] == "video":
+		return "https://vimeo.com/" + segments[1], true
+	case host == "vimeo.com" && len(segments) == 1 && segments[0] != "":
+		return "https://vimeo.com/" + segments[0], true
+	}
+
+	return parsed.String(), isVideoFile(parsed.String())
+}
+
+// isVideoFile tells whether the url points to a video file by its extension
+func isVideoFile(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+
+	return videoExtensions[strings.ToLower(path.Ext(u.Path))]
+}
+
+// fetchVideo archives the video of an embed. The returned db.Item only describes the file
+func fetchVideo(ctx context.Context, e Embed) (db.Item, error) {
+	if e.Direct {
+		return download(ctx, e.Url, "")
+	}
+	if len(videoDownloader) == 0 {
+		return db.Item{}, errors.New(fmt.Sprintf("Error fetching %s: no video downloader configured", e.Url))
+	}
+
+	tmp, err := ioutil.TempDir("archive", ".video-")
+	if err != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Error fetching %s: %s", e.Url, err))
+	}
+	defer os.RemoveAll(tmp)
+
+	file, err := runDownloader(ctx, videoDownloader, e.Url, tmp)
+	if err != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Error fetching %s: %s", e.Url, err))
+	}
+
+	return archiveFile(file, "archive")
+}
+
+// runDownloader runs the command in dir to download the video at the given url and returns the path of the largest file it created
+func runDownloader(ctx context.Context, command []string, videoUrl string, dir string) (string, error) {
+	args := make([]string, 0, len(command))
+	replaced := false
+	for _, a := range command[1:] {
+		if strings.Contains(a, "{url}") {
+			a = strings.Replace(a, "{url}", videoUrl, -1)
+			replaced = true
+		}
+		args = append(args, a)
+	}
+	if !replaced {
+		args = append(args, videoUrl)
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("%s failed: %s %s", command[0], err, lastLine(output)))
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	largest := ""
+	var size int64 = -1
+	for _, f := range files {
+		if f.Mode().IsRegular() && f.Size() > size {
+			largest, size = f.Name(), f.Size()
+		}
+	}
+	if largest == "" {
+		return "", errors.New(fmt.Sprintf("%s did not download anything", command[0]))
+	}
+
+	return filepath.Join(dir, largest), nil
+}
+
+// archiveFile moves a downloaded file into the archive directory without replacing existing files and describes it
+func archiveFile(file string, dir string) (db.Item, error) {
+	head := make([]byte, 512)
+	f, err := os.Open(file)
+	if err != nil {
+		return db.Item{}, err
+	}
+	n, _ := f.Read(head)
+	f.Close()
+	mimeType := mediaType(sniff(head[:n]), mime.TypeByExtension(filepath.Ext(file)), "")
+
+	name := db.FreeFilename(dir, filepath.Base(file), nil)
+	target := filepath.Join(dir, name)
+	err = os.Rename(file, target)
+	if err != nil {
+		return db.Item{}, errors.New(fmt.Sprintf("Error moving %s to %s: %s", file, target, err))
+	}
+	size, checksum, err := db.FileChecksum(target)
+	if err != nil {
+		return db.Item{}, err
+	}
+
+	return db.Item{Filename: name, Size: size, MimeType: mimeType, Sha256: checksum}, nil
+}
+
+// lastLine returns the last non empty line of the output of a command, which usually holds the error message
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,142 @@
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+func TestFindEmbed(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		item     feed.Item
+		url      string
+		direct   bool
+		notFound bool
+	}{
+		{name: "youtube iframe", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: `<iframe width="560" src="//www.youtube.com/embed/abc123?rel=0" allowfullscreen></iframe>`}}, url: "https://www.youtube.com/watch?v=abc123"},
+		{name: "youtube object", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: `<object><param name="movie" value="http://www.youtube.com/v/abc123&amp;hl=de"></param></object>`}}, url: "https://www.youtube.com/watch?v=abc123"},
+		{name: "youtube url", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: "http://youtu.be/abc123"}}, url: "https://www.youtube.com/watch?v=abc123"},
+		{name: "vimeo in description", item: feed.Item{Description: `<p>look</p><iframe src="https://player.vimeo.com/video/4711?title=0"></iframe>`}, url: "https://vimeo.com/4711"},
+		{name: "soup video", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: `<video controls><source src="http://asset-a.soupcdn.com/asset/1/2.mp4" type="video/mp4"></video>`}}, url: "http://asset-a.soupcdn.com/asset/1/2.mp4", direct: true},
+		{name: "other player in video post", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: `<iframe src="https://example.com/player/1"></iframe>`}}, url: "https://example.com/player/1"},
+		{name: "other player in text post", item: feed.Item{Description: `<iframe src="https://example.com/player/1"></iframe>`}, notFound: true},
+		{name: "image post", item: feed.Item{Attributes: feed.Attributes{Type: "image", Url: "http://example.com/a.gif"}, Description: `<iframe src="https://www.youtube.com/embed/abc123"></iframe>`}, notFound: true},
+		{name: "no urls", item: feed.Item{Attributes: feed.Attributes{Type: "video", Embed: `<b>gone</b>`}}, notFound: true},
+	} {
+		e, ok := FindEmbed(c.item)
+		if ok == c.notFound {
+			t.Fatalf("%s: Expected found to be %t, got %t", c.name, !c.notFound, ok)
+		}
+		if e.Url != c.url || e.Direct != c.direct {
+			t.Fatalf("%s: Expected url %s and direct %t, got %s and %t", c.name, c.url, c.direct, e.Url, e.Direct)
+		}
+		if ok && e.Code == "" {
+			t.Fatalf("%s: Expected the embed code to be kept", c.name)
+		}
+	}
+}
+
+func TestFetchDirectVideo(t *testing.T) {
+	mockOsLayer := testOsLayer{}
+	osl = &mockOsLayer
+	mockHttpClient := &testHttpClient{}
+	mockHttpClient.response.StatusCode = http.StatusOK
+	mockHttpClient.response.Body = &testBody{}
+	httpc = mockHttpClient
+	code := `<video src="http://asset-a.soupcdn.com/asset/1/2.mp4"></video>`
+	i := feed.Item{Guid: "video", Link: "http://foo.soup.io/post/1"}
+	i.Attributes.Type = "video"
+	i.Attributes.Embed = code
+
+	item, err := Fetch(context.Background(), i, db.Archive{})
+	if err != nil {
+		t.Fatal("Expected successful fetch, got", err)
+	}
+	if mockHttpClient.askedForUrl != "http://asset-a.soupcdn.com/asset/1/2.mp4" {
+		t.Fatal("Expected the video file to be fetched, got", mockHttpClient.askedForUrl)
+	}
+	if item.Filename != "2.mp4" || item.SourceUrl != "http://asset-a.soupcdn.com/asset/1/2.mp4" || item.Embed != code {
+		t.Fatalf("Expected item to describe the video and keep the embed code, got %+v", item)
+	}
+}
+
+func TestFetchVideoWithoutDownloader(t *testing.T) {
+	mockHttpClient := &testHttpClient{}
+	httpc = mockHttpClient
+	UseVideoDownloader(nil)
+	i := feed.Item{Guid: "video"}
+	i.Attributes.Embed = "https://vimeo.com/4711"
+
+	_, err := Fetch(context.Background(), i, db.Archive{})
+	if err == nil {
+		t.Fatal("Expected error without video downloader, got nil")
+	}
+	if mockHttpClient.askedForUrl != "" {
+		t.Fatal("Expected no http get for a video page, got one for", mockHttpClient.askedForUrl)
+	}
+}
+
+func TestRunDownloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "souparchive-video-test")
+	if err != nil {
+		t.Fatal("Could not create temp dir. Error in test!", err)
+	}
+	defer os.RemoveAll(dir)
+	work := filepath.Join(dir, "work")
+	os.Mkdir(work, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "clip.mp4"), []byte("existing"), 0644)
+
+	command := []string{"sh", "-c", `printf "%s %s" "$1" "downloaded video" > clip.mp4 && printf x > clip.info`, "sh", "{url}"}
+	file, err := runDownloader(context.Background(), command, "https://vimeo.com/4711", work)
+	if err != nil {
+		t.Fatal("Expected downloader to succeed, got", err)
+	}
+	if filepath.Base(file) != "clip.mp4" {
+		t.Fatal("Expected the largest file to be picked, got", file)
+	}
+
+	item, err := archiveFile(file, dir)
+	if err != nil {
+		t.Fatal("Expected file to be archived, got", err)
+	}
+	if item.Filename != "clip-1.mp4" || item.MimeType != "video/mp4" || item.Size == 0 || item.Sha256 == "" {
+		t.Fatalf("Expected clip-1.mp4 next to the existing file, got %+v", item)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, item.Filename))
+	if !strings.HasPrefix(string(data), "https://vimeo.com/4711 ") {
+		t.Fatal("Expected the url to be passed to the downloader, got", string(data))
+	}
+
+	_, err = runDownloader(context.Background(), []string{"sh", "-c", "echo not available >&2; exit 1"}, "https://vimeo.com/4711", work)
+	if err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Fatal("Expected the error of the downloader, got", err)
+	}
+}
+
+func TestPlanVideo(t *testing.T) {
+	httpc = &testHttpClient{}
+	items := make([]feed.Item, 1)
+	items[0].Guid = "video"
+	items[0].Attributes.Embed = `<iframe src="https://www.youtube.com/embed/abc123"></iframe>`
+
+	UseVideoDownloader(nil)
+	p := NewPlan(context.Background(), items, db.Archive{})
+	if p.Items[0].Action != ActionSkip || p.Items[0].Url != "https://www.youtube.com/watch?v=abc123" {
+		t.Fatalf("Expected video to be skipped without downloader, got %+v", p.Items[0])
+	}
+
+	UseVideoDownloader([]string{"yt-dlp"})
+	defer UseVideoDownloader(nil)
+	p = NewPlan(context.Background(), items, db.Archive{})
+	if p.Items[0].Action != ActionDownload || p.Items[0].Bytes != -1 {
+		t.Fatalf("Expected video to be downloaded with unknown size, got %+v", p.Items[0])
+	}
+}
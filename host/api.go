@@ -0,0 +1,346 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+	"github.com/bestform/souparchive/stats"
+)
+
+// apiPrefix is where version 1 of the json api is served
+const apiPrefix = "/api/v1/"
+
+// apiItem is an item as returned by the api, including links to the media
+type apiItem struct {
+	db.Item
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnail_url"`
+}
+
+// apiList is a single page of items
+type apiList struct {
+	Items   []apiItem `json:"items"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"per_page"`
+	Total   int       `json:"total"`
+}
+
+// apiStats summarizes the archive
+type apiStats struct {
+	Items  int            `json:"items"`
+	Bytes  int64          `json:"bytes"`
+	ByType map[string]int `json:"by_type"`
+	Oldest int64          `json:"oldest"`
+	Newest int64          `json:"newest"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func newApiItem(i db.Item) apiItem {
+	return apiItem{Item: i, Url: "/images/" + url.PathEscape(i.Filename), ThumbnailUrl: "/thumbs/" + url.PathEscape(i.Filename)}
+}
+
+// apiTags lists the tags of an item or all tags with their number of items
+type apiTags struct {
+	Tags interface{} `json:"tags"`
+}
+
+// apiCollection is a named collection with its items in the order they were added
+type apiCollection struct {
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description,omitempty"`
+	Count       int       `json:"count"`
+	Items       []apiItem `json:"items,omitempty"`
+}
+
+// hostApi dispatches all requests below apiPrefix. Everything but the tags and annotations of an item is read only
+func (s *Server) hostApi(w http.ResponseWriter, r *http.Request) {
+	route := strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix)
+	for _, sub := range []string{"/tags", "/annotations"} {
+		if !strings.HasPrefix(route, "items/") || !strings.HasSuffix(route, sub) {
+			continue
+		}
+		guid, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(route, "items/"), sub))
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, apiError{"invalid guid"})
+			return
+		}
+		if sub == "/tags" {
+			s.apiItemTags(w, r, guid)
+		} else {
+			s.apiItemAnnotations(w, r, guid)
+		}
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJson(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+		return
+	}
+
+	switch {
+	case route == "items":
+		s.apiItems(w, r)
+	case strings.HasPrefix(route, "items/"):
+		guid, err := url.PathUnescape(strings.TrimPrefix(route, "items/"))
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, apiError{"invalid guid"})
+			return
+		}
+		s.apiItemDetail(w, r, guid)
+	case route == "stats":
+		writeJson(w, http.StatusOK, summarize(s.visibleItems(r)))
+	case route == "tags":
+		writeJson(w, http.StatusOK, apiTags{db.CountTags(s.visibleItems(r))})
+	case route == "collections":
+		list := []apiCollection{}
+		for _, c := range s.allCollections() {
+			list = append(list, apiCollection{Name: c.Name, Slug: db.Slug(c.Name), Description: c.Description, Count: len(collectionItems(c, s.visibleItems(r)))})
+		}
+		writeJson(w, http.StatusOK, list)
+	case strings.HasPrefix(route, "collections/"):
+		c, ok := findCollection(s.allCollections(), strings.TrimPrefix(route, "collections/"))
+		if !ok {
+			writeJson(w, http.StatusNotFound, apiError{"not found"})
+			return
+		}
+		result := apiCollection{Name: c.Name, Slug: db.Slug(c.Name), Description: c.Description, Items: []apiItem{}}
+		for _, i := range collectionItems(c, s.visibleItems(r)) {
+			result.Items = append(result.Items, newApiItem(i))
+		}
+		result.Count = len(result.Items)
+		writeJson(w, http.StatusOK, result)
+	default:
+		writeJson(w, http.StatusNotFound, apiError{"not found"})
+	}
+}
+
+// apiItemTags returns the tags of the item with the given guid. PUT replaces them with the tags in the body,
+// e.g. {"tags": ["cats", "funny"]}, and returns the changed item
+func (s *Server) apiItemTags(w http.ResponseWriter, r *http.Request, guid string) {
+	item, ok := findGuid(s.visibleItems(r), guid)
+	if !ok {
+		writeJson(w, http.StatusNotFound, apiError{"no item with guid " + guid})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tags := item.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		writeJson(w, http.StatusOK, apiTags{tags})
+	case http.MethodPut:
+		if !s.canEdit(r) {
+			writeJson(w, http.StatusForbidden, apiError{"forbidden"})
+			return
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&body)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, apiError{"invalid body: " + err.Error()})
+			return
+		}
+		_, err = s.setTags(guid, body.Tags)
+		if err != nil {
+			writeJson(w, http.StatusInternalServerError, apiError{err.Error()})
+			return
+		}
+		item, _ = findGuid(s.all(), guid)
+		writeJson(w, http.StatusOK, newApiItem(item))
+	default:
+		writeJson(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+	}
+}
+
+// apiItemAnnotations returns the annotations of the item with the given guid. PATCH changes the annotations given in
+// the body, e.g. {"favorite": true, "rating": 4}, and returns the changed item
+func (s *Server) apiItemAnnotations(w http.ResponseWriter, r *http.Request, guid string) {
+	item, ok := findGuid(s.visibleItems(r), guid)
+	if !ok {
+		writeJson(w, http.StatusNotFound, apiError{"no item with guid " + guid})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJson(w, http.StatusOK, db.Annotation{Favorite: &item.Favorite, Note: &item.Note, Rating: &item.Rating})
+	case http.MethodPatch:
+		if !s.canEdit(r) {
+			writeJson(w, http.StatusForbidden, apiError{"forbidden"})
+			return
+		}
+		var an db.Annotation
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&an)
+		if err == nil {
+			err = an.Validate()
+		}
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, apiError{"invalid body: " + err.Error()})
+			return
+		}
+		_, err = s.annotate(guid, an)
+		if err != nil {
+			writeJson(w, http.StatusInternalServerError, apiError{err.Error()})
+			return
+		}
+		item, _ = findGuid(s.all(), guid)
+		writeJson(w, http.StatusOK, newApiItem(item))
+	default:
+		writeJson(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+	}
+}
+
+// apiItems lists items newest first. Supported query parameters are page, per_page, from and to
+// (RFC 3339 or yyyy-mm-dd), type (media type or its prefix like image), tag, favorite (true or false), min_rating
+// and q (search in guid and filename)
+func (s *Server) apiItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, err := intParam(q, "page", 1)
+	if err != nil || page < 1 {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid page"})
+		return
+	}
+	perPage, err := intParam(q, "per_page", perPage)
+	if err != nil || perPage < 1 || perPage > 500 {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid per_page, must be between 1 and 500"})
+		return
+	}
+	from, err := timeParam(q, "from", false)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid from: " + err.Error()})
+		return
+	}
+	to, err := timeParam(q, "to", true)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid to: " + err.Error()})
+		return
+	}
+
+	minRating, err := intParam(q, "min_rating", 0)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid min_rating"})
+		return
+	}
+	favorite := q.Get("favorite")
+	if favorite != "" && favorite != "true" && favorite != "false" {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid favorite, must be true or false"})
+		return
+	}
+
+	var matches []db.Item
+	for _, i := range s.visibleItems(r) {
+		if !from.IsZero() && i.Timestamp < from.Unix() {
+			continue
+		}
+		if !to.IsZero() && i.Timestamp > to.Unix() {
+			continue
+		}
+		if t := q.Get("type"); t != "" && i.MimeType != t && !strings.HasPrefix(i.MimeType, t+"/") {
+			continue
+		}
+		if favorite != "" && i.Favorite != (favorite == "true") {
+			continue
+		}
+		if i.Rating < minRating {
+			continue
+		}
+		if tag := q.Get("tag"); tag != "" && !i.HasTag(tag) {
+			continue
+		}
+		if search := strings.ToLower(q.Get("q")); search != "" && !strings.Contains(strings.ToLower(i.Guid), search) && !strings.Contains(strings.ToLower(i.Filename), search) {
+			continue
+		}
+		matches = append(matches, i)
+	}
+
+	// like the pages of the timeline, only the first page may be empty. The offset is only computed for pages
+	// that exist, so a huge page can not overflow it
+	if page > 1 && page-1 >= (len(matches)+perPage-1)/perPage {
+		writeJson(w, http.StatusNotFound, apiError{"no page " + strconv.Itoa(page) + ", there are only " + strconv.Itoa(len(matches)) + " items"})
+		return
+	}
+	list := apiList{Items: []apiItem{}, Page: page, PerPage: perPage, Total: len(matches)}
+	for n := (page - 1) * perPage; n < len(matches) && n < page*perPage; n++ {
+		list.Items = append(list.Items, newApiItem(matches[n]))
+	}
+	writeJson(w, http.StatusOK, list)
+}
+
+// apiItemDetail returns the item with the given guid
+func (s *Server) apiItemDetail(w http.ResponseWriter, r *http.Request, guid string) {
+	i, ok := findGuid(s.visibleItems(r), guid)
+	if !ok {
+		writeJson(w, http.StatusNotFound, apiError{"no item with guid " + guid})
+		return
+	}
+	writeJson(w, http.StatusOK, newApiItem(i))
+}
+
+// findGuid returns the item with the given guid
+func findGuid(items []db.Item, guid string) (db.Item, bool) {
+	for _, i := range items {
+		if i.Guid == guid {
+			return i, true
+		}
+	}
+
+	return db.Item{}, false
+}
+
+// summarize summarizes the given items in the shape of the api
+func summarize(items []db.Item) apiStats {
+	st := stats.Compute(items, metrics.Store{}, stats.DefaultTop)
+	s := apiStats{Items: st.Items, Bytes: st.Bytes, ByType: map[string]int{}, Oldest: st.Oldest, Newest: st.Newest}
+	for _, c := range st.ByType {
+		s.ByType[c.Name] = c.Items
+	}
+
+	return s
+}
+
+func intParam(q url.Values, name string, fallback int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(v)
+}
+
+// timeParam parses RFC 3339 times or dates. A date given as end of a range includes the whole day
+func timeParam(q url.Values, name string, end bool) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+
+	return t, nil
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,97 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func apiFixture(t *testing.T) *Server {
+	return newTestServer(t, DefaultConfig(), []db.Item{
+		{Guid: "http://foo.soup.io/post/3", Timestamp: 1488000000, Filename: "c.mp4", MimeType: "video/mp4", Size: 30},
+		{Guid: "http://foo.soup.io/post/2", Timestamp: 1487945669, Filename: "b.gif", MimeType: "image/gif", Size: 20},
+		{Guid: "http://foo.soup.io/post/1", Timestamp: 1487859269, Filename: "a.jpg", MimeType: "image/jpeg", Size: 10},
+	})
+}
+
+func getApi(t *testing.T, s *Server, url string, v interface{}) int {
+	req := httptest.NewRequest("GET", url, nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if v != nil {
+		err := json.Unmarshal(rec.Body.Bytes(), v)
+		if err != nil {
+			t.Fatalf("Expected json from %s, got %s", url, rec.Body.String())
+		}
+	}
+
+	return rec.Code
+}
+
+func TestApiItemsPagination(t *testing.T) {
+	s := apiFixture(t)
+	var list apiList
+	code := getApi(t, s, "/api/v1/items?per_page=2&page=2", &list)
+	if code != http.StatusOK {
+		t.Fatal("Expected status 200, got", code)
+	}
+	if list.Total != 3 || len(list.Items) != 1 || list.Items[0].Guid != "http://foo.soup.io/post/1" {
+		t.Fatalf("Expected last item on second page of 3, got %d items of %d", len(list.Items), list.Total)
+	}
+	if list.Items[0].Url != "/images/a.jpg" {
+		t.Fatal("Expected url of media, got", list.Items[0].Url)
+	}
+
+	for _, query := range []string{"per_page=2&page=3", "per_page=3&page=2", "per_page=2&page=4611686018427387904"} {
+		if code := getApi(t, s, "/api/v1/items?"+query, nil); code != http.StatusNotFound {
+			t.Fatalf("Expected status 404 for %s beyond the last page, got %d", query, code)
+		}
+	}
+	if code := getApi(t, s, "/api/v1/items?q=nothing", &list); code != http.StatusOK || list.Total != 0 {
+		t.Fatal("Expected empty first page, got", code, list.Total)
+	}
+}
+
+func TestApiItemsFilter(t *testing.T) {
+	s := apiFixture(t)
+	var list apiList
+	getApi(t, s, "/api/v1/items?type=image", &list)
+	if list.Total != 2 {
+		t.Fatal("Expected 2 images, got", list.Total)
+	}
+	getApi(t, s, "/api/v1/items?from=2017-02-24&to=2017-02-24", &list)
+	if list.Total != 1 || list.Items[0].Filename != "b.gif" {
+		t.Fatal("Expected only b.gif on 2017-02-24, got", list.Total)
+	}
+	getApi(t, s, "/api/v1/items?q=post/3", &list)
+	if list.Total != 1 || list.Items[0].Filename != "c.mp4" {
+		t.Fatal("Expected search to find c.mp4, got", list.Total)
+	}
+	if code := getApi(t, s, "/api/v1/items?from=yesterday", nil); code != http.StatusBadRequest {
+		t.Fatal("Expected status 400 on invalid date, got", code)
+	}
+}
+
+func TestApiItemDetail(t *testing.T) {
+	s := apiFixture(t)
+	var item apiItem
+	code := getApi(t, s, "/api/v1/items/http%3A%2F%2Ffoo.soup.io%2Fpost%2F2", &item)
+	if code != http.StatusOK || item.Filename != "b.gif" {
+		t.Fatal("Expected b.gif, got", code, item.Filename)
+	}
+	if code := getApi(t, s, "/api/v1/items/unknown", nil); code != http.StatusNotFound {
+		t.Fatal("Expected status 404 on unknown guid, got", code)
+	}
+}
+
+func TestApiStats(t *testing.T) {
+	s := apiFixture(t)
+	var stats apiStats
+	getApi(t, s, "/api/v1/stats", &stats)
+	if stats.Items != 3 || stats.Bytes != 60 || stats.ByType["image/gif"] != 1 || stats.Oldest != 1487859269 {
+		t.Fatalf("Wrong stats: %+v", stats)
+	}
+}
@@ -0,0 +1,264 @@
+package host
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// Config contains the settings of the host server
+type Config struct {
+	Listen string `json:"listen"`
+	// Users maps user names to passwords. They can log in via the login page or HTTP basic auth
+	Users map[string]string `json:"users"`
+	// Tokens are accepted as bearer token in the Authorization header or as token query parameter, e.g. for feed readers
+	Tokens []string `json:"tokens"`
+	// PrivateAccounts lists the accounts whose items are only shown to authenticated clients
+	PrivateAccounts []string `json:"private_accounts"`
+	// RequireAuth makes the whole archive private
+	RequireAuth bool `json:"require_auth"`
+	// TLS configures HTTPS. Without it the archive is served via plain HTTP
+	TLS TLSConfig `json:"tls"`
+	// Templates is the directory containing the templates of the site
+	Templates string `json:"templates"`
+}
+
+// DefaultConfig returns the configuration used if nothing else is specified. The self signed certificate is kept
+// outside of the archive directory, which is served
+func DefaultConfig() Config {
+	return Config{Listen: ":8080", TLS: TLSConfig{Dir: "tls"}, Templates: "host/templates"}
+}
+
+// authEnabled tells whether any credentials are configured
+func (c Config) authEnabled() bool {
+	return len(c.Users) > 0 || len(c.Tokens) > 0
+}
+
+// isPrivate tells whether the items of the account are hidden from anonymous clients
+func (c Config) isPrivate(account string) bool {
+	for _, a := range c.PrivateAccounts {
+		if a == account {
+			return true
+		}
+	}
+
+	return false
+}
+
+const sessionCookie = "souparchive_session"
+const sessionDuration = 30 * 24 * time.Hour
+
+func newSessionSecret() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+type userKey struct{}
+
+// user returns the name of the authenticated user or token holder of the request
+func user(r *http.Request) (string, bool) {
+	u, ok := r.Context().Value(userKey{}).(string)
+	return u, ok
+}
+
+// authenticate checks the session cookie, HTTP basic auth and tokens
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if u, ok := s.verifySession(c.Value, time.Now()); ok {
+			return u, true
+		}
+	}
+	if u, p, ok := r.BasicAuth(); ok && s.checkPassword(u, p) {
+		return u, true
+	}
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	if token != "" {
+		for _, t := range s.config.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return "token", true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (s *Server) checkPassword(u, p string) bool {
+	expected, ok := s.config.Users[u]
+	if !ok {
+		// compare anyway to not reveal which users exist
+		expected = string(s.sessionSecret)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(p), []byte(expected)) == 1 && ok
+}
+
+// signSession produces the value of the session cookie for the user
+func (s *Server) signSession(u string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(u)) + "|" + strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, s.sessionSecret)
+	mac.Write([]byte(payload))
+
+	return payload + "|" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession returns the user of a valid, not yet expired session cookie
+func (s *Server) verifySession(value string, now time.Time) (string, bool) {
+	parts := strings.Split(value, "|")
+	if len(parts) != 3 {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, s.sessionSecret)
+	mac.Write([]byte(parts[0] + "|" + parts[1]))
+	sum, err := hex.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sum, mac.Sum(nil)) {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", false
+	}
+	u, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+
+	return string(u), true
+}
+
+// withAuth authenticates every request. If the whole archive is private, anonymous clients are sent to the
+// login page or get a 401 for everything that is not a html page. The metrics are private as soon as credentials exist
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := s.authenticate(r)
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), userKey{}, u))
+		}
+
+		needsAuth := s.config.RequireAuth || (s.config.authEnabled() && r.URL.Path == "/metrics")
+		if !ok && needsAuth && r.URL.Path != "/login" && r.URL.Path != "/logout" {
+			if isPage(r.URL.Path) {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="souparchive"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isPage tells whether the path belongs to a html page rather than media, feeds or the api
+func isPage(p string) bool {
+	for _, prefix := range []string{"/images/", "/thumbs/", apiPrefix, "/feed.", "/metrics"} {
+		if strings.HasPrefix(p, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// visibleItems returns the items the client of the request may see
+func (s *Server) visibleItems(r *http.Request) []db.Item {
+	all := s.all()
+	if _, ok := user(r); ok || len(s.config.PrivateAccounts) == 0 {
+		return all
+	}
+
+	var visible []db.Item
+	for _, i := range all {
+		if !s.config.isPrivate(i.Account) {
+			visible = append(visible, i)
+		}
+	}
+
+	return visible
+}
+
+// visibleFile tells whether the client of the request may download the archived file. Files shared by
+// items of public and private accounts are visible
+func (s *Server) visibleFile(r *http.Request, filename string) bool {
+	if _, ok := user(r); ok || len(s.config.PrivateAccounts) == 0 {
+		return true
+	}
+	for _, i := range s.all() {
+		if i.Filename == filename && !s.config.isPrivate(i.Account) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localPath tells whether the redirect target stays on this server. Browsers treat backslashes like slashes
+// and drop control characters, so /\evil.com would lead to another host
+func localPath(target string) bool {
+	if strings.Contains(target, `\`) || strings.IndexFunc(target, unicode.IsControl) >= 0 {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(target, "//")
+}
+
+// hostLogin shows the login form and starts a session for valid credentials
+func (s *Server) hostLogin(w http.ResponseWriter, r *http.Request) {
+	next := r.FormValue("next")
+	if !localPath(next) {
+		next = "/"
+	}
+
+	p := page{Title: "login", Redirect: next}
+	if r.Method == http.MethodPost {
+		u := r.FormValue("user")
+		if s.checkPassword(u, r.FormValue("password")) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    s.signSession(u, time.Now().Add(sessionDuration)),
+				Path:     "/",
+				MaxAge:   int(sessionDuration.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		p.Error = "Wrong user or password"
+	}
+
+	s.render(w, r, "login.html", p)
+}
+
+// hostLogout ends the session
+func (s *Server) hostLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
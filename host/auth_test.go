@@ -0,0 +1,151 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func authFixture(t *testing.T, c Config) *Server {
+	return newTestServer(t, c, []db.Item{
+		{Guid: "1", Account: "public", Timestamp: 200, Filename: "a.gif"},
+		{Guid: "2", Account: "secret", Timestamp: 100, Filename: "b.gif"},
+	})
+}
+
+func TestSession(t *testing.T) {
+	s := authFixture(t, Config{})
+	now := time.Now()
+	value := s.signSession("alice", now.Add(time.Hour))
+
+	if u, ok := s.verifySession(value, now); !ok || u != "alice" {
+		t.Fatal("Expected valid session for alice, got", u, ok)
+	}
+	if _, ok := s.verifySession(value, now.Add(2*time.Hour)); ok {
+		t.Fatal("Expected expired session to be rejected")
+	}
+	if _, ok := s.verifySession(strings.Replace(value, "YWxpY2U", "Ym9i", 1), now); ok {
+		t.Fatal("Expected tampered session to be rejected")
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	h := authFixture(t, Config{Users: map[string]string{"alice": "wonderland"}, Tokens: []string{"t0ken"}, RequireAuth: true})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/login") {
+		t.Fatal("Expected anonymous page request to be redirected to login, got", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatal("Expected anonymous api request to be unauthorized, got", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+	req.SetBasicAuth("alice", "wonderland")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Expected basic auth to be accepted, got", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/stats", nil)
+	req.SetBasicAuth("alice", "wrong")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatal("Expected wrong password to be rejected, got", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/stats", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Expected token to be accepted, got", rec.Code)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	h := authFixture(t, Config{Users: map[string]string{"alice": "wonderland"}, RequireAuth: true})
+
+	form := url.Values{"user": {"alice"}, "password": {"wonderland"}, "next": {"/page-1.html"}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/page-1.html" {
+		t.Fatal("Expected redirect after login, got", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("Expected session cookie, got", cookies)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "logout") {
+		t.Fatal("Expected logged in page, got", rec.Code)
+	}
+
+	form.Set("password", "wrong")
+	req = httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Fatal("Expected wrong password to be rejected, got", rec.Code)
+	}
+}
+
+func TestLoginRedirectsOnlyLocally(t *testing.T) {
+	h := authFixture(t, Config{Users: map[string]string{"alice": "wonderland"}, RequireAuth: true})
+
+	for next, expected := range map[string]string{
+		"/tags/cats.html":         "/tags/cats.html",
+		"//evil.com":              "/",
+		`/\evil.com`:              "/",
+		"/\t/evil.com":            "/",
+		"http://evil.com/":        "/",
+		"javascript:alert(1)":     "/",
+		"tags/cats.html":          "/",
+		"/%5Cevil.com/index.html": "/%5Cevil.com/index.html",
+	} {
+		form := url.Values{"user": {"alice"}, "password": {"wonderland"}, "next": {next}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if location := rec.Header().Get("Location"); location != expected {
+			t.Fatalf("Expected login with next %q to redirect to %s, got %s", next, expected, location)
+		}
+	}
+}
+
+func TestPrivateAccounts(t *testing.T) {
+	h := authFixture(t, Config{Users: map[string]string{"alice": "wonderland"}, PrivateAccounts: []string{"secret"}})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "a.gif") || strings.Contains(rec.Body.String(), "b.gif") {
+		t.Fatal("Expected only public items for anonymous clients")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", "wonderland")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "b.gif") {
+		t.Fatal("Expected private items for authenticated clients")
+	}
+}
@@ -0,0 +1,111 @@
+package host
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// calendarLevels is the number of shades of the calendar heatmap, not counting days without items
+const calendarLevels = 4
+
+// calendarYear is one year of the calendar heatmap. Rows are the weekdays starting with Sunday,
+// columns the weeks of the year
+type calendarYear struct {
+	Year  string
+	Count int
+	Rows  [7][]calendarDay
+}
+
+// calendarDay is a single cell of the heatmap. Date is empty for cells before the first or after the last day of the year
+type calendarDay struct {
+	Date  string
+	Count int
+	// Level is the shade of the cell from 0 for no items to calendarLevels for the most active day of the archive
+	Level int
+	Link  string
+}
+
+// group is a list of items with a heading
+type group struct {
+	Name  string
+	Items []db.Item
+}
+
+// calendar produces the heatmap of every year with published items, newest first. Items are expected to be sorted ByTime
+func calendar(items []db.Item) []calendarYear {
+	counts := map[string]int{}
+	max := 0
+	for _, i := range items {
+		d := periodName(i, dayLayout)
+		counts[d]++
+		if counts[d] > max {
+			max = counts[d]
+		}
+	}
+
+	var years []calendarYear
+	for _, p := range periods(items, yearLayout) {
+		year, _ := strconv.Atoi(p.Name)
+		y := calendarYear{Year: p.Name, Count: p.Count}
+
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		// start with the sunday of the first week, so every row is a single weekday
+		day := first.AddDate(0, 0, -int(first.Weekday()))
+		for day.Year() <= year {
+			cell := calendarDay{}
+			if day.Year() == year {
+				cell.Date = day.Format(dayLayout)
+				cell.Count = counts[cell.Date]
+				if cell.Count > 0 {
+					cell.Level = (cell.Count*calendarLevels + max - 1) / max
+					cell.Link = "dates/" + cell.Date + ".html"
+				}
+			}
+			y.Rows[day.Weekday()] = append(y.Rows[day.Weekday()], cell)
+			day = day.AddDate(0, 0, 1)
+		}
+		years = append(years, y)
+	}
+
+	return years
+}
+
+// onThisDay groups the items published on the given day of the year in years before the given one by year, newest first.
+// monthDay has the format 01-02
+func onThisDay(items []db.Item, monthDay string, before int) []group {
+	var groups []group
+	for _, i := range items {
+		t := time.Unix(i.Timestamp, 0).UTC()
+		if t.Format("01-02") != monthDay || t.Year() >= before {
+			continue
+		}
+		year := t.Format(yearLayout)
+		if len(groups) == 0 || groups[len(groups)-1].Name != year {
+			groups = append(groups, group{Name: year})
+		}
+		groups[len(groups)-1].Items = append(groups[len(groups)-1].Items, i)
+	}
+
+	return groups
+}
+
+// daysOfYear lists every day of the year, e.g. 02-24, with published items and the number of items, in calendar order
+func daysOfYear(items []db.Item) []period {
+	counts := map[string]int{}
+	for _, i := range items {
+		counts[time.Unix(i.Timestamp, 0).UTC().Format("01-02")]++
+	}
+
+	var result []period
+	// 2016 is a leap year, so the 29th of February is included
+	for day := time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC); day.Year() == 2016; day = day.AddDate(0, 0, 1) {
+		name := day.Format("01-02")
+		if counts[name] > 0 {
+			result = append(result, period{Name: name, Link: "onthisday/" + name + ".html", Count: counts[name]})
+		}
+	}
+
+	return result
+}
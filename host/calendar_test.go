@@ -0,0 +1,93 @@
+package host
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func calendarFixture() []db.Item {
+	date := func(s string) int64 {
+		t, _ := time.Parse("2006-01-02 15:04", s)
+		return t.Unix()
+	}
+
+	return []db.Item{
+		{Guid: "5", Timestamp: date("2017-02-24 12:00")},
+		{Guid: "4", Timestamp: date("2017-02-24 10:00")},
+		{Guid: "3", Timestamp: date("2016-02-24 10:00")},
+		{Guid: "2", Timestamp: date("2016-01-03 10:00")},
+		{Guid: "1", Timestamp: date("2015-02-24 10:00")},
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	items := calendarFixture()
+
+	years := periods(items, yearLayout)
+	if len(years) != 3 || years[0].Name != "2017" || years[0].Count != 2 || years[0].Link != "dates/2017.html" {
+		t.Fatal("Expected 3 years, newest first, got", years)
+	}
+	if days := periods(periodItems(items, "2016"), dayLayout); len(days) != 2 || days[1].Name != "2016-01-03" {
+		t.Fatal("Expected 2 days in 2016, got", days)
+	}
+	if periodItems(items, "2016-13") != nil {
+		t.Fatal("Expected no items for an invalid month")
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	years := calendar(calendarFixture())
+	if len(years) != 3 || years[1].Year != "2016" || years[1].Count != 2 {
+		t.Fatal("Expected 3 years, newest first, got", len(years))
+	}
+
+	// the 1st of January 2016 was a friday, so the first week has 5 empty cells
+	y := years[1]
+	if y.Rows[time.Sunday][0].Date != "" || y.Rows[time.Friday][0].Date != "2016-01-01" {
+		t.Fatal("Expected first week to start on sunday with padding, got", y.Rows[time.Friday][0])
+	}
+	// the 3rd of January 2016 was a sunday in the second week
+	if d := y.Rows[time.Sunday][1]; d.Date != "2016-01-03" || d.Count != 1 || d.Link != "dates/2016-01-03.html" {
+		t.Fatal("Expected the 3rd of January in the second column, got", d)
+	}
+	// the most active day of the archive is the 24th of February 2017 with 2 items
+	if years[0].Rows[time.Friday][7].Level != calendarLevels || y.Rows[time.Sunday][1].Level != calendarLevels/2 {
+		t.Fatal("Expected levels relative to the most active day")
+	}
+}
+
+func TestOnThisDay(t *testing.T) {
+	groups := onThisDay(calendarFixture(), "02-24", 2017)
+	if len(groups) != 2 || groups[0].Name != "2016" || groups[1].Name != "2015" {
+		t.Fatal("Expected items of 2016 and 2015, got", groups)
+	}
+
+	days := daysOfYear(calendarFixture())
+	if len(days) != 2 || days[0].Name != "01-03" || days[1].Count != 4 {
+		t.Fatal("Expected 2 days of the year in calendar order, got", days)
+	}
+}
+
+func TestOnThisDayPage(t *testing.T) {
+	s := newTestServer(t, DefaultConfig(), calendarFixture())
+	s.now = func() time.Time { return time.Date(2017, time.February, 24, 8, 0, 0, 0, time.UTC) }
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/onthisday/index.html", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "<h2>2016</h2>") || !strings.Contains(body, "<h2>2015</h2>") || strings.Contains(body, "<h2>2017</h2>") {
+		t.Fatal("Expected items of previous years only, got", body)
+	}
+
+	// shortly after midnight in Berlin it is still the 24th in UTC
+	s.now = func() time.Time { return time.Date(2017, time.February, 25, 0, 30, 0, 0, time.FixedZone("CET", 3600)) }
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/onthisday/index.html", nil))
+	if !strings.Contains(rec.Body.String(), "on this day: 24 February") || !strings.Contains(rec.Body.String(), "<h2>2016</h2>") {
+		t.Fatal("Expected today to be the day in UTC, got", rec.Body.String())
+	}
+}
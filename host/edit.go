@@ -0,0 +1,132 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// maxBodySize limits the size of the bodies of requests changing the archive
+const maxBodySize = 1 << 20
+
+// canEdit tells whether the client may change the archive. If credentials are configured, only authenticated clients
+// may, otherwise only clients on this machine. Requests from other sites are always rejected
+func (s *Server) canEdit(r *http.Request) bool {
+	if !sameOrigin(r) {
+		return false
+	}
+	if _, ok := user(r); ok {
+		return true
+	}
+
+	return !s.config.authEnabled() && loopback(r)
+}
+
+// loopback tells whether the request has been sent from this machine
+func loopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin tells whether the request has been sent by a page of this site. Clients that send no Origin header,
+// e.g. scripts, are accepted
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+
+	return err == nil && u.Host == r.Host
+}
+
+// update applies f to the archive file and reloads the in-memory view. The file is only written if f returns true.
+// Changes made via the server are serialized, the archive is read again before every change
+func (s *Server) update(f func(a *db.Archive) bool) (bool, error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	a := db.NewArchive(s.archivePath())
+	a.Read()
+	if !f(&a) {
+		return false, nil
+	}
+	err := a.Persist()
+	if err != nil {
+		return true, err
+	}
+	s.Reload()
+
+	return true, nil
+}
+
+// setTags replaces the tags of the item with the given guid. It returns false if there is no such item
+func (s *Server) setTags(guid string, tags []string) (bool, error) {
+	return s.update(func(a *db.Archive) bool {
+		return a.SetTags(guid, tags)
+	})
+}
+
+// annotate applies the annotation to the item with the given guid. It returns false if there is no such item
+func (s *Server) annotate(guid string, an db.Annotation) (bool, error) {
+	err := an.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	return s.update(func(a *db.Archive) bool {
+		ok, _ := a.Annotate(guid, an)
+		return ok
+	})
+}
+
+// editForm reads the tags and annotations posted with the form on the page of an item. Fields missing in the form
+// are not changed, so tags is nil if they are not part of it
+func editForm(r *http.Request) (tags []string, an db.Annotation, err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return nil, an, err
+	}
+
+	if v, ok := r.PostForm["tags"]; ok {
+		tags = strings.Split(v[0], ",")
+	}
+	// the checkbox is preceded by a hidden field, so the last value is the state of the checkbox
+	if v, ok := r.PostForm["favorite"]; ok {
+		favorite := v[len(v)-1] == "on"
+		an.Favorite = &favorite
+	}
+	if v, ok := r.PostForm["note"]; ok {
+		an.Note = &v[0]
+	}
+	if v := r.PostForm.Get("rating"); v != "" {
+		rating, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, an, errors.New("Invalid rating " + v)
+		}
+		an.Rating = &rating
+	}
+
+	return tags, an, an.Validate()
+}
+
+// edit changes the tags and annotations of the item with the given guid in a single update. Nil tags are kept
+func (s *Server) edit(guid string, tags []string, an db.Annotation) (bool, error) {
+	return s.update(func(a *db.Archive) bool {
+		if tags != nil {
+			a.SetTags(guid, tags)
+		}
+		ok, _ := a.Annotate(guid, an)
+		return ok
+	})
+}
@@ -0,0 +1,190 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+	"github.com/bestform/souparchive/stats"
+	"github.com/bestform/souparchive/thumb"
+)
+
+// Export renders the archive in archiveDir as a static site into outDir using the templates in templateDir. All links are relative,
+// so the result can be published on any static hosting or opened from disk. Files missing in the archive are
+// skipped and returned, the pages of their items are rendered nonetheless
+func Export(archiveDir, outDir, templateDir string) ([]string, error) {
+	archive := db.NewArchive(filepath.Join(archiveDir, "archive.json"))
+	archive.Read()
+	items := make([]db.Item, len(archive.Data.Items))
+	copy(items, archive.Data.Items)
+	sort.Sort(ByTime(items))
+	posts := postNames(items)
+
+	for _, dir := range []string{"images", thumb.Dir, "posts", "dates", "tags", "collections", "favorites", "calendar", "onthisday", "stats"} {
+		err := os.MkdirAll(filepath.Join(outDir, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// copy media and previews, remembering which previews exist. Items may share a file, which is copied only once
+	var missing []string
+	thumbs := map[string]string{}
+	copied := map[string]bool{}
+	for _, i := range items {
+		if copied[i.Filename] {
+			continue
+		}
+		copied[i.Filename] = true
+		err := copyFile(filepath.Join(archiveDir, i.Filename), filepath.Join(outDir, "images", i.Filename))
+		if os.IsNotExist(err) {
+			missing = append(missing, i.Filename)
+			continue
+		}
+		if err != nil {
+			return missing, err
+		}
+
+		// previews missing in the archive are generated into the site, so the archive is left untouched
+		name := thumb.Find(archiveDir, i.Filename)
+		if name == "" {
+			name, err = thumb.GenerateInto(filepath.Join(archiveDir, i.Filename), filepath.Join(outDir, thumb.Dir), thumb.DefaultWidth)
+			if err != nil {
+				// no preview for this kind of file
+				continue
+			}
+		} else {
+			err = copyFile(filepath.Join(archiveDir, thumb.Dir, name), filepath.Join(outDir, thumb.Dir, name))
+			if err != nil {
+				return missing, err
+			}
+		}
+		thumbs[i.Filename] = name
+	}
+
+	t, err := parseTemplates(templateDir, func(i db.Item) string {
+		if name, ok := thumbs[i.Filename]; ok {
+			return thumb.Dir + "/" + name
+		}
+		return "images/" + i.Filename
+	}, func(i db.Item) string { return posts[i.Guid] })
+	if err != nil {
+		return missing, err
+	}
+
+	render := func(path, name string, p page) error {
+		f, err := os.Create(filepath.Join(outDir, path))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		err = t.ExecuteTemplate(f, name, p)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Error rendering %s: %s", path, err))
+		}
+		return nil
+	}
+
+	for n := 1; n <= timelinePages(items); n++ {
+		err := render(timelineLink(n), "index.html", timelinePage(items, n))
+		if err != nil {
+			return missing, err
+		}
+	}
+	for _, i := range items {
+		err := render(filepath.Join("posts", posts[i.Guid]+".html"), "post.html", page{Root: "../", Title: i.Filename, Item: i})
+		if err != nil {
+			return missing, err
+		}
+	}
+	err = render(filepath.Join("dates", "index.html"), "dates.html", page{Root: "../", Title: "by date", Periods: periods(items, yearLayout)})
+	if err != nil {
+		return missing, err
+	}
+	for _, layout := range []string{yearLayout, monthLayout, dayLayout} {
+		for _, p := range periods(items, layout) {
+			template, pg := periodPage(p.Name, periodItems(items, p.Name))
+			err := render(filepath.Join("dates", p.Name+".html"), template, pg)
+			if err != nil {
+				return missing, err
+			}
+		}
+	}
+	err = render(filepath.Join("calendar", "index.html"), "calendar.html", page{Root: "../", Title: "calendar", Calendar: calendar(items)})
+	if err != nil {
+		return missing, err
+	}
+	st := stats.Compute(items, metrics.NewStore(""), stats.DefaultTop)
+	err = render(filepath.Join("stats", "index.html"), "stats.html", page{Root: "../", Title: "stats", Stats: &st})
+	if err != nil {
+		return missing, err
+	}
+	// a static site does not know which day it is, so all days with items are listed
+	days := daysOfYear(items)
+	err = render(filepath.Join("onthisday", "index.html"), "dates.html", page{Root: "../", Title: "on this day", Periods: days})
+	if err != nil {
+		return missing, err
+	}
+	for _, d := range days {
+		day, _ := time.Parse("01-02", d.Name)
+		err := render(filepath.Join("onthisday", d.Name+".html"), "index.html", page{Root: "../", Title: day.Format("2 January"), Groups: onThisDay(items, d.Name, math.MaxInt32)})
+		if err != nil {
+			return missing, err
+		}
+	}
+	tagPeriods := tags(items)
+	err = render(filepath.Join("tags", "index.html"), "dates.html", page{Root: "../", Title: "tags", Periods: tagPeriods})
+	if err != nil {
+		return missing, err
+	}
+	for _, p := range tagPeriods {
+		err := render(filepath.Join("tags", p.Name+".html"), "index.html", page{Root: "../", Title: p.Name, Items: tagItems(items, p.Name)})
+		if err != nil {
+			return missing, err
+		}
+	}
+	err = render(filepath.Join("favorites", "index.html"), "index.html", page{Root: "../", Title: "favorites", Items: db.Favorites(items)})
+	if err != nil {
+		return missing, err
+	}
+	err = render(filepath.Join("collections", "index.html"), "dates.html", page{Root: "../", Title: "collections", Periods: collections(archive.Data.Collections, items)})
+	if err != nil {
+		return missing, err
+	}
+	for _, c := range archive.Data.Collections {
+		err := render(filepath.Join("collections", db.Slug(c.Name)+".html"), "index.html", page{Root: "../", Title: c.Name, Description: c.Description, Items: collectionItems(c, items)})
+		if err != nil {
+			return missing, err
+		}
+	}
+
+	return missing, nil
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,65 @@
+package host
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func TestExport(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-export-test")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	archiveDir := filepath.Join(dir, "archive")
+	outDir := filepath.Join(dir, "site")
+	os.MkdirAll(archiveDir, 0755)
+
+	f, _ := os.Create(filepath.Join(archiveDir, "a.png"))
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 800, 800)))
+	f.Close()
+	ioutil.WriteFile(filepath.Join(archiveDir, "b.mp4"), []byte("no image"), 0644)
+
+	a := db.NewArchive(filepath.Join(archiveDir, "archive.json"))
+	a.Add("1", 1487859269, "a.png")
+	a.Add("2", 1487945669, "b.mp4")
+	a.Tag("1", "cats")
+	a.Add("3", 1487945670, "gone.gif")
+	a.AddToCollection("Best of", "2", "1")
+	a.Persist()
+
+	missing, err := Export(archiveDir, outDir, "templates")
+	if err != nil {
+		t.Fatal("Expected site to be exported, got", err)
+	}
+	if len(missing) != 1 || missing[0] != "gone.gif" {
+		t.Fatal("Expected the missing file to be skipped and reported, got", missing)
+	}
+
+	for _, f := range []string{"index.html", "posts/a.png.html", "posts/b.mp4.html", "posts/gone.gif.html", "dates/index.html", "dates/2017.html", "dates/2017-02.html", "dates/2017-02-23.html", "calendar/index.html", "onthisday/index.html", "onthisday/02-24.html", "tags/index.html", "tags/cats.html", "collections/index.html", "collections/best-of.html", "favorites/index.html", "stats/index.html", "images/a.png", "images/b.mp4", "thumbs/a.png.png"} {
+		if _, err := os.Stat(filepath.Join(outDir, f)); err != nil {
+			t.Fatalf("Expected %s to be exported, got %s", f, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(archiveDir, "thumbs")); !os.IsNotExist(err) {
+		t.Fatal("Expected export not to write previews into the archive, got", err)
+	}
+
+	index, _ := ioutil.ReadFile(filepath.Join(outDir, "index.html"))
+	if !strings.Contains(string(index), `src="thumbs/a.png.png"`) {
+		t.Fatal("Expected index to link the preview of a.png")
+	}
+	if !strings.Contains(string(index), `src="images/b.mp4"`) {
+		t.Fatal("Expected index to link the original of b.mp4 without preview")
+	}
+	post, _ := ioutil.ReadFile(filepath.Join(outDir, "posts", "a.png.html"))
+	if !strings.Contains(string(post), `src="../images/a.png"`) {
+		t.Fatal("Expected post page to link the original relative to the site root")
+	}
+}
@@ -1,21 +1,31 @@
 package host
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"net/http"
-
-	"sort"
-
 	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+	"github.com/bestform/souparchive/stats"
+	"github.com/bestform/souparchive/thumb"
 )
 
 type entry struct {
 	url string
 }
 
-var localFeed []db.Item
+// shutdownTimeout is how long running requests may take after the host has been asked to stop
+const shutdownTimeout = 10 * time.Second
 
 type ByTime []db.Item
 
@@ -23,30 +33,390 @@ func (a ByTime) Len() int           { return len(a) }
 func (a ByTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByTime) Less(i, j int) bool { return a[i].Timestamp > a[j].Timestamp }
 
-// Host will host the current archive on localhost via the specified port
-func Host(port string) error {
-	archive := db.NewArchive("archive/archive.json")
-	archive.Read()
+// Server hosts the archive in a single directory. It owns its in-memory view of the archive, its routes and
+// templates, so several servers can run side by side. All handlers are safe for concurrent use
+type Server struct {
+	dir       string
+	config    Config
+	handler   http.Handler
+	templates *template.Template
+	// sessionSecret signs the session cookies. It is created with the server, so all sessions end with a restart
+	sessionSecret []byte
+
+	// lock guards items, collections, posts, files, mimeTypes and noThumbnail, which are replaced as a whole on reload
+	lock        sync.RWMutex
+	items       []db.Item
+	collections []db.Collection
+	// posts maps the guids of the items to the names of their pages
+	posts map[string]string
+	// files are the names of all archived files
+	files map[string]bool
+	// mimeTypes maps archived filenames to the media type detected while archiving
+	mimeTypes map[string]string
+	// modified is the modification time of the archive file when it was loaded
+	modified time.Time
+	// noThumbnail remembers the files no preview can be generated for, e.g. videos, until the next reload
+	noThumbnail map[string]bool
+	// writeLock serializes changes to the archive file made via the server
+	writeLock sync.Mutex
+	// now tells the server what day it is for the on this day page
+	now func() time.Time
+}
+
+// NewServer creates a server for the archive in dir and loads it
+func NewServer(dir string, c Config) (*Server, error) {
+	s := &Server{dir: dir, config: c, sessionSecret: newSessionSecret(), now: time.Now}
+
+	var err error
+	s.templates, err = parseTemplates(c.Templates, func(i db.Item) string { return "thumbs/" + i.Filename }, s.postName)
+	if err != nil {
+		return nil, err
+	}
 
-	localFeed = archive.Data.Items
-	sort.Sort(ByTime(localFeed))
+	mux := http.NewServeMux()
+	mux.Handle("/images/", http.StripPrefix("/images/", s.withVisibleFile(s.withMimeType(http.HandlerFunc(s.hostFile)))))
+	mux.HandleFunc("/thumbs/", s.hostThumbnail)
+	mux.HandleFunc("/metrics", s.hostMetrics)
+	mux.HandleFunc("/feed.rss", s.hostRss)
+	mux.HandleFunc("/feed.atom", s.hostAtom)
+	mux.HandleFunc("/login", s.hostLogin)
+	mux.HandleFunc("/logout", s.hostLogout)
+	mux.HandleFunc("/posts/", s.hostPost)
+	mux.HandleFunc("/dates/", s.hostDates)
+	mux.HandleFunc("/tags/", s.hostTags)
+	mux.HandleFunc("/collections/", s.hostCollections)
+	mux.HandleFunc("/favorites/", s.hostFavorites)
+	mux.HandleFunc("/calendar/", s.hostCalendar)
+	mux.HandleFunc("/onthisday/", s.hostOnThisDay)
+	mux.HandleFunc("/stats/", s.hostStats)
+	mux.HandleFunc("/", s.hostList)
+	// api requests bypass the mux, which would clean escaped slashes in guids and redirect
+	routes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			s.hostApi(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	s.handler = withSecurityHeaders(s.withAuth(routes))
 
-	fs := http.FileServer(http.Dir("archive"))
-	http.Handle("/images/", http.StripPrefix("/images/", fs))
-	http.HandleFunc("/", hostList)
+	s.Reload()
 
-	return http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+	return s, nil
 }
 
-func hostList(w http.ResponseWriter, r *http.Request) {
+// ServeHTTP answers all requests to the hosted archive
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
 
-	t, err := template.New("index.html").ParseFiles("host/templates/index.html")
+// Host will host the archive in the directory archive with the given configuration until ctx is done
+func Host(ctx context.Context, c Config) error {
+	s, err := NewServer("archive", c)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	return s.ListenAndServe(ctx)
+}
+
+// ListenAndServe serves the archive on the configured address until ctx is done. Running requests are finished
+// before it returns. Changes to the archive are picked up while running
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	go s.watch(ctx, s.archivePath(), s.loaded(), reloadInterval)
+
+	servers := []*http.Server{{Addr: s.config.Listen, Handler: s}}
+	if s.config.TLS.enabled() {
+		cert, err := s.config.TLS.certificate()
+		if err != nil {
+			return err
+		}
+		servers[0].TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		if s.config.TLS.RedirectFrom != "" {
+			servers = append(servers, &http.Server{Addr: s.config.TLS.RedirectFrom, Handler: redirectToHttps(s.config.Listen)})
+		}
+	}
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			if server.TLSConfig != nil {
+				errs <- server.ListenAndServeTLS("", "")
+				return
+			}
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		server.Shutdown(shutdownCtx)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// archivePath is the path of the db of the hosted archive
+func (s *Server) archivePath() string {
+	return filepath.Join(s.dir, "archive.json")
+}
+
+func (s *Server) hostList(w http.ResponseWriter, r *http.Request) {
+	n := 1
+	if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+		_, err := fmt.Sscanf(r.URL.Path, "/page-%d.html", &n)
+		if err != nil || n < 1 || n > timelinePages(s.visibleItems(r)) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	s.render(w, r, "index.html", timelinePage(s.visibleItems(r), n))
+}
+
+// hostPost shows a single item at /posts/<name>.html, see postNames. Its tags and annotations are changed by posting the form on the page
+func (s *Server) hostPost(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	item, ok := findPost(s.visibleItems(r), s.postNames(), name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !s.canEdit(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		tags, an, err := editForm(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, err = s.edit(item.Guid, tags, an)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	s.render(w, r, "post.html", page{Root: "../", Title: item.Filename, Item: item, Editable: s.canEdit(r)})
+}
+
+// hostDates shows the index of all years at /dates/index.html, the months of a year at /dates/<yyyy>.html,
+// the days and items of a month at /dates/<yyyy-mm>.html and the items of a day at /dates/<yyyy-mm-dd>.html
+func (s *Server) hostDates(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name == "index" || name == "dates" {
+		s.render(w, r, "dates.html", page{Root: "../", Title: "by date", Periods: periods(s.visibleItems(r), yearLayout)})
+		return
+	}
+
+	items := periodItems(s.visibleItems(r), name)
+	if len(items) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	template, p := periodPage(name, items)
+	s.render(w, r, template, p)
+}
+
+// hostCalendar shows the heatmap of all years at /calendar/index.html
+func (s *Server) hostCalendar(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name != "index" && name != "calendar" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.render(w, r, "calendar.html", page{Root: "../", Title: "calendar", Calendar: calendar(s.visibleItems(r))})
+}
+
+// hostOnThisDay shows the items published today in previous years at /onthisday/index.html and the items of any
+// day of the year at /onthisday/<mm-dd>.html
+func (s *Server) hostOnThisDay(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name == "index" || name == "onthisday" {
+		// items are grouped by their day in UTC, so today has to be as well
+		today := s.now().UTC()
+		s.render(w, r, "index.html", page{Root: "../", Title: "on this day: " + today.Format("2 January"), Groups: onThisDay(s.visibleItems(r), today.Format("01-02"), today.Year())})
+		return
 	}
-	err = t.Execute(w, localFeed)
+
+	day, err := time.Parse("01-02", name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, r, "index.html", page{Root: "../", Title: day.Format("2 January"), Groups: onThisDay(s.visibleItems(r), name, math.MaxInt32)})
+}
+
+// hostTags shows the index of all tags at /tags/index.html and the items of a tag at /tags/<tag>.html
+func (s *Server) hostTags(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name == "index" || name == "tags" {
+		s.render(w, r, "dates.html", page{Root: "../", Title: "tags", Periods: tags(s.visibleItems(r))})
+		return
+	}
+
+	items := tagItems(s.visibleItems(r), name)
+	if len(items) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, r, "index.html", page{Root: "../", Title: name, Items: items})
+}
+
+// hostCollections shows the index of all collections at /collections/index.html and the items of a collection
+// at /collections/<slug>.html
+func (s *Server) hostCollections(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name == "index" || name == "collections" {
+		s.render(w, r, "dates.html", page{Root: "../", Title: "collections", Periods: collections(s.allCollections(), s.visibleItems(r))})
+		return
+	}
+
+	c, ok := findCollection(s.allCollections(), name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, r, "index.html", page{Root: "../", Title: c.Name, Description: c.Description, Items: collectionItems(c, s.visibleItems(r))})
+}
+
+// hostFavorites shows all favorite items at /favorites/index.html
+func (s *Server) hostFavorites(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name != "index" && name != "favorites" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.render(w, r, "index.html", page{Root: "../", Title: "favorites", Items: db.Favorites(s.visibleItems(r))})
+}
+
+// hostStats shows the statistics of the archive at /stats/index.html. Like the metrics, fetch failures are only
+// shown to authenticated clients if credentials are configured
+func (s *Server) hostStats(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(path.Base(r.URL.Path), ".html")
+	if name != "index" && name != "stats" {
+		http.NotFound(w, r)
+		return
+	}
+
+	store := metrics.NewStore(filepath.Join(s.dir, "metrics.json"))
+	if _, ok := user(r); ok || !s.config.authEnabled() {
+		store.Read()
+	}
+	st := stats.Compute(s.visibleItems(r), store, stats.DefaultTop)
+	s.render(w, r, "stats.html", page{Root: "../", Title: "stats", Stats: &st})
+}
+
+// render executes the named template with the given page. Previews are served by hostThumbnail
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, p page) {
+	p.Auth = s.config.authEnabled()
+	p.User, _ = user(r)
+
+	err := s.templates.ExecuteTemplate(w, name, p)
 	if err != nil {
 		panic(err)
 	}
+}
+
+// hostMetrics exposes the metrics of all archive runs and the current archive size for prometheus
+func (s *Server) hostMetrics(w http.ResponseWriter, r *http.Request) {
+	archive := db.NewArchive(s.archivePath())
+	archive.Read()
+	store := metrics.NewStore(filepath.Join(s.dir, "metrics.json"))
+	store.Read()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.Write(w, store, archive)
+}
+
+// hostThumbnail serves the preview of an archived file. Missing previews are generated and cached on first request.
+// If no preview can be generated, e.g. for videos, the client is redirected to the original
+func (s *Server) hostThumbnail(w http.ResponseWriter, r *http.Request) {
+	filename := path.Base(r.URL.Path)
+	if !s.visibleFile(r, filename) {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.lock.RLock()
+	failed := s.noThumbnail[filename]
+	s.lock.RUnlock()
+	if failed {
+		http.Redirect(w, r, "/images/"+filename, http.StatusFound)
+		return
+	}
+
+	name := thumb.Find(s.dir, filename)
+	if name == "" {
+		var err error
+		name, err = thumb.Generate(s.dir, filename, thumb.DefaultWidth)
+		if err != nil {
+			s.lock.Lock()
+			s.noThumbnail[filename] = true
+			s.lock.Unlock()
+			http.Redirect(w, r, "/images/"+filename, http.StatusFound)
+			return
+		}
+	}
+
+	http.ServeFile(w, r, filepath.Join(s.dir, thumb.Dir, name))
+}
+
+// withMimeType sets the Content-Type header to the media type detected while archiving, so it does not depend on the file extension
+func (s *Server) withMimeType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := s.mimeType(path.Base(r.URL.Path)); ok {
+			w.Header().Set("Content-Type", t)
+			if strings.HasPrefix(t, "text/html") {
+				// snapshots of linked pages are sandboxed, so they can neither submit forms nor act on behalf of the user
+				w.Header().Set("Content-Security-Policy", contentSecurityPolicy+"; sandbox")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostFile serves the archived file named by the path below /images/
+func (s *Server) hostFile(w http.ResponseWriter, r *http.Request) {
+	f, err := os.Open(filepath.Join(s.dir, r.URL.Path))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, r.URL.Path, info.ModTime(), f)
+}
 
+// withVisibleFile only lets the files of archived items through and hides those of private accounts from anonymous
+// clients. Everything else in the archive directory, like archive.json, metrics.json or sidecars, is never served
+func (s *Server) withVisibleFile(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.archived(r.URL.Path) || !s.visibleFile(r, r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
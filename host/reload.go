@@ -0,0 +1,148 @@
+package host
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// reloadInterval is how often the archive file is checked for changes
+const reloadInterval = 5 * time.Second
+
+// all returns the current view of the archive. The slice is never modified, only replaced
+func (s *Server) all() []db.Item {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.items
+}
+
+// allCollections returns the current collections of the archive
+func (s *Server) allCollections() []db.Collection {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.collections
+}
+
+// postNames returns the names of the pages of all items by guid
+func (s *Server) postNames() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.posts
+}
+
+// postName returns the name of the page of the item
+func (s *Server) postName(i db.Item) string {
+	if name, ok := s.postNames()[i.Guid]; ok {
+		return name
+	}
+
+	return i.Filename
+}
+
+// archived tells whether the file belongs to an archived item
+func (s *Server) archived(filename string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.files[filename]
+}
+
+// mimeType returns the media type detected for the archived file while archiving
+func (s *Server) mimeType(filename string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	t, ok := s.mimeTypes[filename]
+
+	return t, ok
+}
+
+// Reload reads the archive again and replaces the in-memory view with it. Running requests keep the view they started with
+func (s *Server) Reload() {
+	s.load(s.archivePath())
+}
+
+// load reads the archive at path and replaces the in-memory view with it. It returns the modification time
+// of the file before reading, so changes during the reload are picked up by watch
+func (s *Server) load(path string) time.Time {
+	m := modified(path)
+	archive := db.NewArchive(path)
+	archive.Read()
+	s.replace(archive.Data)
+	s.lock.Lock()
+	s.modified = m
+	s.lock.Unlock()
+
+	return m
+}
+
+// loaded returns the modification time of the archive as currently loaded
+func (s *Server) loaded() time.Time {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.modified
+}
+
+// replace sorts the items ByTime, names their pages and makes them and the collections the in-memory view
+func (s *Server) replace(data db.Data) {
+	items := data.Items
+	sort.Sort(ByTime(items))
+	posts := postNames(items)
+	files := map[string]bool{}
+	types := map[string]string{}
+	for _, i := range items {
+		files[i.Filename] = true
+		if i.MimeType != "" {
+			types[i.Filename] = i.MimeType
+		}
+	}
+
+	s.lock.Lock()
+	s.items = items
+	s.collections = data.Collections
+	s.posts = posts
+	s.files = files
+	s.mimeTypes = types
+	s.noThumbnail = map[string]bool{}
+	s.lock.Unlock()
+}
+
+// watch reloads the archive at path whenever the file changes after last or the process receives SIGHUP, until ctx is done
+func (s *Server) watch(ctx context.Context, path string, last time.Time, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			last = s.load(path)
+		case <-ticker.C:
+			if !modified(path).Equal(last) {
+				last = s.load(path)
+			}
+		}
+	}
+}
+
+// modified returns the modification time of the file or the zero time if it doesn't exist
+func modified(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -0,0 +1,50 @@
+package host
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func TestWatch(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-reload-test")
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "archive.json")
+
+	a := db.NewArchive(path)
+	a.AddItem(db.Item{Guid: "1", Timestamp: 100, Filename: "a.gif", MimeType: "image/gif"})
+	a.Persist()
+	s, err := NewServer(dir, testConfig(DefaultConfig()))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+	if len(s.all()) != 1 {
+		t.Fatal("Expected 1 item after loading, got", len(s.all()))
+	}
+	if m, _ := s.mimeType("a.gif"); m != "image/gif" {
+		t.Fatal("Expected media type of a.gif, got", m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watch(ctx, path, s.loaded(), 10*time.Millisecond)
+
+	a.AddItem(db.Item{Guid: "2", Timestamp: 200, Filename: "b.png", MimeType: "image/png"})
+	a.Persist()
+	// make sure the change is noticed on file systems with a coarse modification time
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.all()) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(s.all()) != 2 || s.all()[0].Guid != "2" {
+		t.Fatal("Expected reloaded items sorted by time, got", s.all())
+	}
+}
@@ -0,0 +1,460 @@
+package host
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// newTestServer creates a server for an empty archive and replaces its view with the given items
+// testConfig makes the server use the templates of the package
+func testConfig(c Config) Config {
+	c.Templates = "templates"
+
+	return c
+}
+
+func newTestServer(t *testing.T, c Config, items []db.Item) *Server {
+	s, err := NewServer(t.TempDir(), testConfig(c))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+	s.replace(db.Data{Items: items})
+
+	return s
+}
+
+// archiveFixture writes an archive with a PNG and a video to a new directory
+func archiveFixture(t *testing.T) string {
+	dir := t.TempDir()
+	f, _ := os.Create(filepath.Join(dir, "a.png"))
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 800, 800)))
+	f.Close()
+	ioutil.WriteFile(filepath.Join(dir, "b.mp4"), []byte("no image"), 0644)
+
+	a := db.NewArchive(filepath.Join(dir, "archive.json"))
+	a.AddItem(db.Item{Guid: "1", Timestamp: 1487859269, Filename: "a.png", MimeType: "image/png"})
+	a.AddItem(db.Item{Guid: "2", Timestamp: 1487945669, Filename: "b.mp4", MimeType: "video/mp4"})
+	a.Tag("1", "cats")
+	favorite := true
+	a.Annotate("2", db.Annotation{Favorite: &favorite})
+	a.AddToCollection("Best of", "2")
+	a.DescribeCollection("Best of", "only the best")
+	a.Persist()
+
+	return dir
+}
+
+func TestRoutes(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(DefaultConfig()))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	tests := []struct {
+		path     string
+		status   int
+		contains string
+	}{
+		{path: "/", status: http.StatusOK, contains: "posts/a.png.html"},
+		{path: "/index.html", status: http.StatusOK, contains: "posts/b.mp4.html"},
+		{path: "/page-2.html", status: http.StatusNotFound},
+		{path: "/posts/a.png.html", status: http.StatusOK, contains: "images/a.png"},
+		{path: "/posts/unknown.png.html", status: http.StatusNotFound},
+		{path: "/dates/index.html", status: http.StatusOK, contains: "dates/2017.html"},
+		{path: "/dates/2017.html", status: http.StatusOK, contains: "dates/2017-02.html"},
+		{path: "/dates/2017-02.html", status: http.StatusOK, contains: "dates/2017-02-23.html"},
+		{path: "/dates/2017-02-24.html", status: http.StatusOK, contains: "posts/b.mp4.html"},
+		{path: "/dates/1999-01.html", status: http.StatusNotFound},
+		{path: "/dates/2017-02-30.html", status: http.StatusNotFound},
+		{path: "/calendar/index.html", status: http.StatusOK, contains: `title="2017-02-23: 1"`},
+		{path: "/onthisday/index.html", status: http.StatusOK, contains: "on this day"},
+		{path: "/onthisday/02-24.html", status: http.StatusOK, contains: "posts/b.mp4.html"},
+		{path: "/onthisday/13-01.html", status: http.StatusNotFound},
+		{path: "/tags/index.html", status: http.StatusOK, contains: "tags/cats.html"},
+		{path: "/tags/cats.html", status: http.StatusOK, contains: "posts/a.png.html"},
+		{path: "/tags/dogs.html", status: http.StatusNotFound},
+		{path: "/collections/index.html", status: http.StatusOK, contains: "collections/best-of.html"},
+		{path: "/collections/best-of.html", status: http.StatusOK, contains: "only the best"},
+		{path: "/collections/unknown.html", status: http.StatusNotFound},
+		{path: "/favorites/index.html", status: http.StatusOK, contains: "posts/b.mp4.html"},
+		{path: "/favorites/other.html", status: http.StatusNotFound},
+		{path: "/stats/index.html", status: http.StatusOK, contains: "image/png"},
+		{path: "/stats/other.html", status: http.StatusNotFound},
+		{path: "/images/a.png", status: http.StatusOK},
+		{path: "/images/unknown.png", status: http.StatusNotFound},
+		{path: "/thumbs/a.png", status: http.StatusOK},
+		{path: "/thumbs/b.mp4", status: http.StatusFound},
+		{path: "/metrics", status: http.StatusOK, contains: "souparchive_"},
+		{path: "/api/v1/stats", status: http.StatusOK, contains: `"items":2`},
+		{path: "/api/v1/tags", status: http.StatusOK, contains: `"cats":1`},
+		{path: "/api/v1/collections", status: http.StatusOK, contains: `"slug":"best-of"`},
+		{path: "/api/v1/collections/best-of", status: http.StatusOK, contains: `"filename":"b.mp4"`},
+		{path: "/api/v1/items/1/tags", status: http.StatusOK, contains: `["cats"]`},
+		{path: "/api/v1/items/2/annotations", status: http.StatusOK, contains: `"favorite":true`},
+		{path: "/api/v1/items?favorite=true", status: http.StatusOK, contains: `"total":1`},
+		{path: "/api/v1/unknown", status: http.StatusNotFound},
+		{path: "/feed.rss", status: http.StatusOK, contains: "<rss"},
+		{path: "/feed.atom", status: http.StatusOK, contains: "<feed"},
+		{path: "/login", status: http.StatusOK, contains: "password"},
+		{path: "/logout", status: http.StatusSeeOther},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.status {
+			t.Fatalf("Expected status %d for %s, got %d", test.status, test.path, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.contains) {
+			t.Fatalf("Expected %s to contain %s, got %s", test.path, test.contains, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/images/b.mp4", nil))
+	if rec.Header().Get("Content-Type") != "video/mp4" {
+		t.Fatal("Expected media type detected while archiving, got", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestServersSideBySide(t *testing.T) {
+	first := newTestServer(t, DefaultConfig(), []db.Item{{Guid: "1", Timestamp: 1, Filename: "first.gif"}})
+	second := newTestServer(t, DefaultConfig(), []db.Item{{Guid: "2", Timestamp: 2, Filename: "second.gif"}})
+
+	for _, test := range []struct {
+		s        *Server
+		expected string
+		other    string
+	}{{first, "first.gif", "second.gif"}, {second, "second.gif", "first.gif"}} {
+		ts := httptest.NewServer(test.s)
+		resp, err := http.Get(ts.URL + "/")
+		if err != nil {
+			t.Fatal("Expected response, got", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+
+		if !strings.Contains(string(body), test.expected) || strings.Contains(string(body), test.other) {
+			t.Fatalf("Expected only %s to be served, got %s", test.expected, body)
+		}
+	}
+}
+
+func TestReloadWhileServing(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(DefaultConfig()))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/items", nil))
+				if rec.Code != http.StatusOK {
+					t.Error("Expected status 200 during reload, got", rec.Code)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		s.Reload()
+	}
+	wg.Wait()
+}
+
+// localRequest creates a request sent from this machine
+func localRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.RemoteAddr = "127.0.0.1:1234"
+
+	return req
+}
+
+func TestEditTags(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(DefaultConfig()))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	req := localRequest("POST", "/posts/b.mp4.html", strings.NewReader("tags=Funny, videos"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatal("Expected redirect after saving tags, got", rec.Code)
+	}
+	if i, _ := findGuid(s.all(), "2"); strings.Join(i.Tags, ",") != "funny,videos" {
+		t.Fatal("Expected tags to be saved, got", i.Tags)
+	}
+
+	req = localRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": ["cats"]}`))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tags":["cats"]`) {
+		t.Fatal("Expected tags to be replaced via api, got", rec.Code, rec.Body.String())
+	}
+
+	a := db.NewArchive(s.archivePath())
+	a.Read()
+	if !a.Data.Items[1].HasTag("cats") {
+		t.Fatal("Expected tags to be persisted, got", a.Data.Items[1].Tags)
+	}
+
+	req = localRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": []}`))
+	req.Header.Set("Origin", "http://evil.example.com")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatal("Expected requests from other sites to be rejected, got", rec.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": []}`))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatal("Expected requests from other machines to be rejected without credentials, got", rec.Code)
+	}
+
+	req = localRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": ["`+strings.Repeat("a", maxBodySize)+`"]}`))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("Expected too large bodies to be rejected, got", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/items?tag=cats", nil))
+	if !strings.Contains(rec.Body.String(), `"total":2`) {
+		t.Fatal("Expected 2 items tagged cats, got", rec.Body.String())
+	}
+}
+
+func TestEditTagsNeedsAuth(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(Config{Users: map[string]string{"alice": "wonderland"}}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": ["cats"]}`))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatal("Expected anonymous edit to be rejected, got", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/posts/b.mp4.html", nil))
+	if strings.Contains(rec.Body.String(), `name="tags"`) {
+		t.Fatal("Expected no edit form for anonymous clients")
+	}
+
+	req = httptest.NewRequest("PUT", "/api/v1/items/2/tags", strings.NewReader(`{"tags": ["cats"]}`))
+	req.SetBasicAuth("alice", "wonderland")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Expected authenticated edit to be accepted, got", rec.Code)
+	}
+}
+
+func TestEditAnnotations(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(DefaultConfig()))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	form := "tags=cats&favorite=off&favorite=on&rating=4&note=from+a+friend"
+	req := localRequest("POST", "/posts/a.png.html", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatal("Expected redirect after saving, got", rec.Code, rec.Body.String())
+	}
+	if i, _ := findGuid(s.all(), "1"); !i.Favorite || i.Rating != 4 || i.Note != "from a friend" {
+		t.Fatalf("Expected annotations to be saved, got %+v", i)
+	}
+
+	req = localRequest("POST", "/posts/a.png.html", strings.NewReader("favorite=off&rating=9"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatal("Expected invalid rating to be rejected, got", rec.Code)
+	}
+
+	req = localRequest("PATCH", "/api/v1/items/1/annotations", strings.NewReader(`{"favorite": false}`))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Expected annotations to be changed via api, got", rec.Code, rec.Body.String())
+	}
+	if i, _ := findGuid(s.all(), "1"); i.Favorite || i.Rating != 4 || !i.HasTag("cats") {
+		t.Fatalf("Expected only favorite to change, got %+v", i)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/items?min_rating=4", nil))
+	if !strings.Contains(rec.Body.String(), `"total":1`) {
+		t.Fatal("Expected 1 item rated 4 or better, got", rec.Body.String())
+	}
+}
+
+func TestStatsFailuresNeedAuth(t *testing.T) {
+	dir := archiveFixture(t)
+	ioutil.WriteFile(filepath.Join(dir, "metrics.json"), []byte(`{"foo": {"fetched": 3, "failed": 1}}`), 0644)
+	s, err := NewServer(dir, testConfig(Config{Users: map[string]string{"alice": "wonderland"}}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/stats/index.html", nil))
+	if strings.Contains(rec.Body.String(), "fetch failures") {
+		t.Fatal("Expected no fetch failures for anonymous clients")
+	}
+
+	req := httptest.NewRequest("GET", "/stats/index.html", nil)
+	req.SetBasicAuth("alice", "wonderland")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "25.0%") {
+		t.Fatal("Expected failure rate for authenticated clients, got", rec.Body.String())
+	}
+}
+
+func TestSnapshotIsSandboxed(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "example.com_article.html"), []byte("<html><form method=post></form></html>"), 0644)
+	a := db.NewArchive(filepath.Join(dir, "archive.json"))
+	a.AddItem(db.Item{Guid: "1", Timestamp: 1487859269, Filename: "example.com_article.html", MimeType: "text/html", SourceUrl: "http://example.com/article", Snapshot: "example.com_article.html"})
+	a.Persist()
+	s, err := NewServer(dir, testConfig(Config{}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/posts/example.com_article.html.html", nil))
+	if !strings.Contains(rec.Body.String(), "archived copy") || !strings.Contains(rec.Body.String(), "http://example.com/article") {
+		t.Fatal("Expected post to link the archived copy and the original, got", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/images/example.com_article.html", nil))
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Header().Get("Content-Security-Policy"), "; sandbox") {
+		t.Fatalf("Expected sandboxed snapshot, got %d with %s", rec.Code, rec.Header().Get("Content-Security-Policy"))
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/index.html", nil))
+	if strings.Contains(rec.Header().Get("Content-Security-Policy"), "sandbox") {
+		t.Fatal("Expected pages of the archive not to be sandboxed")
+	}
+}
+
+func TestMissingThumbnailIsRemembered(t *testing.T) {
+	s, err := NewServer(archiveFixture(t), testConfig(Config{}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	for n := 0; n < 2; n++ {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "/thumbs/b.mp4", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatal("Expected redirect to the original, got", rec.Code)
+		}
+		if !s.noThumbnail["b.mp4"] {
+			t.Fatal("Expected the failed preview to be remembered")
+		}
+	}
+
+	s.Reload()
+	if s.noThumbnail["b.mp4"] {
+		t.Fatal("Expected failed previews to be retried after a reload")
+	}
+}
+
+func TestItemsSharingAFileHaveTheirOwnPages(t *testing.T) {
+	s := newTestServer(t, DefaultConfig(), []db.Item{
+		{Guid: "repost", Timestamp: 200, Filename: "a.png", Note: "the repost"},
+		{Guid: "original", Timestamp: 100, Filename: "a.png", Note: "the original"},
+	})
+
+	for path, note := range map[string]string{"/posts/a.png.html": "the original", "/posts/a.png-1.html": "the repost"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), note) {
+			t.Fatalf("Expected %s to show %s, got %d", path, note, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), `href="posts/a.png.html"`) || !strings.Contains(rec.Body.String(), `href="posts/a.png-1.html"`) {
+		t.Fatal("Expected the timeline to link both pages, got", rec.Body.String())
+	}
+}
+
+func TestOnlyArchivedFilesAreServed(t *testing.T) {
+	dir := archiveFixture(t)
+	os.MkdirAll(filepath.Join(dir, "tls"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "tls", "key.pem"), []byte("PRIVATE KEY"), 0600)
+	s, err := NewServer(dir, testConfig(Config{Users: map[string]string{"alice": "wonderland"}}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	for _, user := range []string{"", "alice"} {
+		req := httptest.NewRequest("GET", "/images/tls/key.pem", nil)
+		if user != "" {
+			req.SetBasicAuth(user, "wonderland")
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "PRIVATE KEY") {
+			t.Fatalf("Expected the key not to be served to %q, got %d", user, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/images/a.png", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatal("Expected archived files to be served, got", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestArchiveDataIsNotServedAsImages(t *testing.T) {
+	dir := archiveFixture(t)
+	ioutil.WriteFile(filepath.Join(dir, "metrics.json"), []byte(`{"foo": {"fetched": 3, "failed": 1}}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a.png.meta.json"), []byte(`{"guid": "1"}`), 0644)
+	s, err := NewServer(dir, testConfig(Config{Users: map[string]string{"alice": "wonderland"}}))
+	if err != nil {
+		t.Fatal("Expected server to be created, got", err)
+	}
+
+	for _, p := range []string{"/metrics", "/images/metrics.json", "/images/archive.json", "/images/a.png.meta.json"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", p, nil))
+		if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "fetched") || strings.Contains(rec.Body.String(), "guid") {
+			t.Fatalf("Expected %s not to be served to anonymous clients, got %d", p, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package host
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/stats"
+)
+
+// perPage is the number of items on a single page of the timeline
+const perPage = 50
+
+// page is the data every template is rendered with
+type page struct {
+	// Root is the relative path from the page to the root of the site, so all links work without a server as well
+	Root    string
+	Title   string
+	Items   []db.Item
+	Item    db.Item
+	Periods []period
+	Prev    string
+	Next    string
+	// Auth is set if the server has credentials configured, User if the client is logged in
+	Auth bool
+	User string
+	// Redirect is where to go after logging in, Error explains why logging in failed
+	Redirect string
+	Error    string
+	// Editable shows the forms for changing an item, Description explains a collection
+	Editable    bool
+	Description string
+	Calendar    []calendarYear
+	Groups      []group
+	Stats       *stats.Stats
+}
+
+// period is one entry of the date index
+type period struct {
+	Name  string
+	Link  string
+	Count int
+}
+
+// parseTemplates loads all templates in dir. thumb produces the link to the preview of an item relative to the root of
+// the site, post the name of its page
+func parseTemplates(dir string, thumb, post func(db.Item) string) (*template.Template, error) {
+	return template.New("").Funcs(template.FuncMap{
+		"thumb": thumb,
+		"post":  post,
+		"date": func(timestamp int64) string {
+			return time.Unix(timestamp, 0).UTC().Format("2 January 2006 15:04")
+		},
+		"video": func(mimeType string) bool {
+			return strings.HasPrefix(mimeType, "video/")
+		},
+		"join":      strings.Join,
+		"tagLink":   tagLink,
+		"maxRating": func() int { return db.MaxRating },
+		"bytes":     stats.FormatBytes,
+		"percent": func(f float64) string {
+			return fmt.Sprintf("%.1f%%", f*100)
+		},
+		"ratings": func() []int {
+			r := make([]int, db.MaxRating+1)
+			for n := range r {
+				r[n] = n
+			}
+			return r
+		},
+	}).ParseGlob(filepath.Join(dir, "*.html"))
+}
+
+// timelineLink is the link to the given page of the timeline relative to the root of the site. Pages are counted from 1
+func timelineLink(n int) string {
+	if n == 1 {
+		return "index.html"
+	}
+
+	return fmt.Sprintf("page-%d.html", n)
+}
+
+// timelinePage produces the given page of the timeline. Items are expected to be sorted ByTime. Pages are counted from 1
+func timelinePage(items []db.Item, n int) page {
+	p := page{Title: "souparchive"}
+	start := (n - 1) * perPage
+	if start < 0 || start >= len(items) {
+		return p
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	p.Items = items[start:end]
+	if n > 1 {
+		p.Prev = timelineLink(n - 1)
+	}
+	if end < len(items) {
+		p.Next = timelineLink(n + 1)
+	}
+
+	return p
+}
+
+// timelinePages is the number of pages of the timeline
+func timelinePages(items []db.Item) int {
+	n := (len(items) + perPage - 1) / perPage
+	if n == 0 {
+		return 1
+	}
+
+	return n
+}
+
+// layouts of the names of years, months and days, which are also the names of their pages below dates
+const (
+	yearLayout  = "2006"
+	monthLayout = "2006-01"
+	dayLayout   = "2006-01-02"
+)
+
+// periodName returns the name of the year, month or day an item was published in, depending on the layout
+func periodName(i db.Item, layout string) string {
+	return time.Unix(i.Timestamp, 0).UTC().Format(layout)
+}
+
+// periods lists every year, month or day with published items and the number of items. Items are expected to be sorted ByTime
+func periods(items []db.Item, layout string) []period {
+	var result []period
+	for _, i := range items {
+		name := periodName(i, layout)
+		if len(result) > 0 && result[len(result)-1].Name == name {
+			result[len(result)-1].Count++
+			continue
+		}
+		result = append(result, period{Name: name, Link: "dates/" + name + ".html", Count: 1})
+	}
+
+	return result
+}
+
+// layoutOf returns the layout of the name of a year, month or day or an empty string for other names
+func layoutOf(name string) string {
+	for _, layout := range []string{yearLayout, monthLayout, dayLayout} {
+		if _, err := time.Parse(layout, name); err == nil {
+			return layout
+		}
+	}
+
+	return ""
+}
+
+// periodItems returns all items published in the named year, month or day
+func periodItems(items []db.Item, name string) []db.Item {
+	layout := layoutOf(name)
+	if layout == "" {
+		return nil
+	}
+
+	var result []db.Item
+	for _, i := range items {
+		if periodName(i, layout) == name {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
+
+// postNames maps the guid of every item to the name of its page. Pages are named after the archived file.
+// Items sharing a file, like linked reposts, are told apart by a counter in the order they were published, so the
+// first one keeps the plain name. Items are expected to be sorted ByTime
+func postNames(items []db.Item) map[string]string {
+	names := map[string]string{}
+	taken := map[string]int{}
+	for n := len(items) - 1; n >= 0; n-- {
+		i := items[n]
+		name := i.Filename
+		if count := taken[i.Filename]; count > 0 {
+			name = fmt.Sprintf("%s-%d", i.Filename, count)
+		}
+		taken[i.Filename]++
+		names[i.Guid] = name
+	}
+
+	return names
+}
+
+// findPost returns the item whose page has the given name
+func findPost(items []db.Item, names map[string]string, name string) (db.Item, bool) {
+	for _, i := range items {
+		if names[i.Guid] == name {
+			return i, true
+		}
+	}
+
+	return db.Item{}, false
+}
+
+// tagLink is the link to the page of the tag relative to the root of the site
+func tagLink(tag string) string {
+	return "tags/" + url.PathEscape(tag) + ".html"
+}
+
+// tags lists every tag with the number of its items, sorted by name
+func tags(items []db.Item) []period {
+	counts := db.CountTags(items)
+	periods := make([]period, 0, len(counts))
+	for t, n := range counts {
+		periods = append(periods, period{Name: t, Link: tagLink(t), Count: n})
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Name < periods[j].Name })
+
+	return periods
+}
+
+// tagItems returns all items with the given tag
+func tagItems(items []db.Item, tag string) []db.Item {
+	var result []db.Item
+	for _, i := range items {
+		if i.HasTag(tag) {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
+
+// collections lists every collection with the number of its items that are contained in the given items
+func collections(cs []db.Collection, items []db.Item) []period {
+	var periods []period
+	for _, c := range cs {
+		slug := db.Slug(c.Name)
+		periods = append(periods, period{Name: c.Name, Link: "collections/" + url.PathEscape(slug) + ".html", Count: len(collectionItems(c, items))})
+	}
+
+	return periods
+}
+
+// collectionItems returns the items of the collection in the order they were added. Guids not contained in items are skipped
+func collectionItems(c db.Collection, items []db.Item) []db.Item {
+	byGuid := map[string]db.Item{}
+	for _, i := range items {
+		byGuid[i.Guid] = i
+	}
+
+	var result []db.Item
+	for _, g := range c.Guids {
+		if i, ok := byGuid[g]; ok {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
+
+// findCollection returns the collection with the given slug
+func findCollection(cs []db.Collection, slug string) (db.Collection, bool) {
+	for _, c := range cs {
+		if db.Slug(c.Name) == slug {
+			return c, true
+		}
+	}
+
+	return db.Collection{}, false
+}
+
+// periodPage produces the page of the named year, month or day with the given items. Years list their months,
+// months their days and items, days only their items
+func periodPage(name string, items []db.Item) (string, page) {
+	switch layoutOf(name) {
+	case yearLayout:
+		return "dates.html", page{Root: "../", Title: name, Periods: periods(items, monthLayout)}
+	case monthLayout:
+		return "index.html", page{Root: "../", Title: name, Periods: periods(items, dayLayout), Items: items}
+	}
+
+	return "index.html", page{Root: "../", Title: name, Items: items}
+}
@@ -0,0 +1,257 @@
+package host
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// namespaces used in the feeds
+const (
+	atomNamespace    = "http://www.w3.org/2005/Atom"
+	historyNamespace = "http://purl.org/syndication/history/1.0"
+)
+
+// feedPage is one document of a feed as described in RFC 5005, section 4. The subscription document holds the newest
+// items, archive documents hold complete pages counted from the oldest item, so their content never changes
+type feedPage struct {
+	Items []db.Item
+	// Archive is the number of the archive document, 0 for the subscription document
+	Archive int
+	// PrevArchive and NextArchive are the numbers of the neighbouring archive documents, 0 if there is none
+	PrevArchive int
+	NextArchive int
+}
+
+// newFeedPage produces the requested document. Items are expected to be sorted ByTime. ok is false for unknown archive documents
+func newFeedPage(items []db.Item, archive int) (feedPage, bool) {
+	complete := len(items) / perPage
+	p := feedPage{Archive: archive}
+	if archive == 0 {
+		n := perPage
+		if n > len(items) {
+			n = len(items)
+		}
+		p.Items = items[:n]
+		p.PrevArchive = complete
+		return p, true
+	}
+	if archive < 1 || archive > complete {
+		return p, false
+	}
+
+	// items are sorted newest first, archive documents are counted from the oldest
+	end := len(items) - (archive-1)*perPage
+	p.Items = items[end-perPage : end]
+	if archive > 1 {
+		p.PrevArchive = archive - 1
+	}
+	if archive < complete {
+		p.NextArchive = archive + 1
+	}
+
+	return p, true
+}
+
+type atomLink struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom link"`
+	Rel     string   `xml:"rel,attr"`
+	Href    string   `xml:"href,attr"`
+	Type    string   `xml:"type,attr,omitempty"`
+	Length  int64    `xml:"length,attr,omitempty"`
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string     `xml:"title"`
+	Link        string     `xml:"link"`
+	Description string     `xml:"description"`
+	Archive     *struct{}  `xml:"http://purl.org/syndication/history/1.0 archive"`
+	Links       []atomLink `xml:"http://www.w3.org/2005/Atom link"`
+	Items       []rssItem  `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	Link      string       `xml:"link"`
+	Guid      rssGuid      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Archive *struct{}   `xml:"http://purl.org/syndication/history/1.0 archive"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	Id      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+}
+
+// baseUrl is the absolute url of the site as requested by the client
+func baseUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + "/"
+}
+
+// feedLink is the absolute url of the given document of the feed
+func feedLink(base, name string, archive int) string {
+	if archive == 0 {
+		return base + name
+	}
+
+	return fmt.Sprintf("%s%s?archive=%d", base, name, archive)
+}
+
+// historyLinks produces the RFC 5005 links of the document
+func historyLinks(base, name, contentType string, p feedPage) []atomLink {
+	links := []atomLink{{Rel: "self", Href: feedLink(base, name, p.Archive), Type: contentType}}
+	if p.Archive != 0 {
+		links = append(links, atomLink{Rel: "current", Href: feedLink(base, name, 0), Type: contentType})
+	}
+	if p.PrevArchive != 0 {
+		links = append(links, atomLink{Rel: "prev-archive", Href: feedLink(base, name, p.PrevArchive), Type: contentType})
+	}
+	if p.NextArchive != 0 {
+		links = append(links, atomLink{Rel: "next-archive", Href: feedLink(base, name, p.NextArchive), Type: contentType})
+	}
+
+	return links
+}
+
+// requestedFeedPage reads the archive parameter and answers with 404 for unknown documents
+func (s *Server) requestedFeedPage(w http.ResponseWriter, r *http.Request) (feedPage, bool) {
+	archive := 0
+	if v := r.URL.Query().Get("archive"); v != "" {
+		var err error
+		archive, err = strconv.Atoi(v)
+		if err != nil {
+			http.NotFound(w, r)
+			return feedPage{}, false
+		}
+	}
+	p, ok := newFeedPage(s.visibleItems(r), archive)
+	if !ok {
+		http.NotFound(w, r)
+	}
+
+	return p, ok
+}
+
+// hostRss serves the archive as RSS 2.0 feed at /feed.rss
+func (s *Server) hostRss(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.requestedFeedPage(w, r)
+	if !ok {
+		return
+	}
+	base := baseUrl(r)
+
+	doc := rssDocument{Version: "2.0", Channel: rssChannel{
+		Title:       "souparchive",
+		Link:        base,
+		Description: "archived soup.io posts",
+		Links:       historyLinks(base, "feed.rss", "application/rss+xml", p),
+	}}
+	if p.Archive != 0 {
+		doc.Channel.Archive = &struct{}{}
+	}
+	for _, i := range p.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:     i.Filename,
+			Link:      base + "posts/" + url.PathEscape(s.postName(i)) + ".html",
+			Guid:      rssGuid{Value: i.Guid},
+			PubDate:   time.Unix(i.Timestamp, 0).UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{Url: base + "images/" + url.PathEscape(i.Filename), Length: i.Size, Type: mediaTypeOf(i)},
+		})
+	}
+
+	writeXml(w, "application/rss+xml; charset=utf-8", doc)
+}
+
+// hostAtom serves the archive as Atom feed at /feed.atom
+func (s *Server) hostAtom(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.requestedFeedPage(w, r)
+	if !ok {
+		return
+	}
+	base := baseUrl(r)
+
+	doc := atomFeed{
+		Title:  "souparchive",
+		Id:     feedLink(base, "feed.atom", p.Archive),
+		Author: "souparchive",
+		Links:  append([]atomLink{{Rel: "alternate", Href: base, Type: "text/html"}}, historyLinks(base, "feed.atom", "application/atom+xml", p)...),
+	}
+	if p.Archive != 0 {
+		doc.Archive = &struct{}{}
+	}
+	updated := int64(0)
+	for _, i := range p.Items {
+		if i.Timestamp > updated {
+			updated = i.Timestamp
+		}
+		doc.Entries = append(doc.Entries, atomEntry{
+			Title:   i.Filename,
+			Id:      i.Guid,
+			Updated: time.Unix(i.Timestamp, 0).UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Href: base + "posts/" + url.PathEscape(s.postName(i)) + ".html", Type: "text/html"},
+				{Rel: "enclosure", Href: base + "images/" + url.PathEscape(i.Filename), Type: mediaTypeOf(i), Length: i.Size},
+			},
+		})
+	}
+	doc.Updated = time.Unix(updated, 0).UTC().Format(time.RFC3339)
+
+	writeXml(w, "application/atom+xml; charset=utf-8", doc)
+}
+
+// mediaTypeOf is the media type of the item as used in enclosures
+func mediaTypeOf(i db.Item) string {
+	if i.MimeType == "" {
+		return "application/octet-stream"
+	}
+
+	return i.MimeType
+}
+
+func writeXml(w http.ResponseWriter, contentType string, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(v)
+}
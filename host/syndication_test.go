@@ -0,0 +1,85 @@
+package host
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// feedFixture fills the archive with 120 items, newest first
+func feedFixture(t *testing.T) *Server {
+	var items []db.Item
+	for n := 120; n > 0; n-- {
+		items = append(items, db.Item{Guid: fmt.Sprint(n), Timestamp: int64(n), Filename: fmt.Sprint(n, ".gif"), MimeType: "image/gif", Size: 3})
+	}
+
+	return newTestServer(t, DefaultConfig(), items)
+}
+
+func TestFeedPages(t *testing.T) {
+	items := feedFixture(t).all()
+
+	current, _ := newFeedPage(items, 0)
+	if len(current.Items) != perPage || current.Items[0].Guid != "120" || current.PrevArchive != 2 {
+		t.Fatalf("Expected newest %d items pointing to archive 2, got %d items pointing to %d", perPage, len(current.Items), current.PrevArchive)
+	}
+
+	oldest, _ := newFeedPage(items, 1)
+	if oldest.Items[len(oldest.Items)-1].Guid != "1" || oldest.PrevArchive != 0 || oldest.NextArchive != 2 {
+		t.Fatal("Expected first archive document to end with the oldest item and point to archive 2")
+	}
+
+	if _, ok := newFeedPage(items, 3); ok {
+		t.Fatal("Expected incomplete page not to be an archive document")
+	}
+}
+
+func TestRss(t *testing.T) {
+	s := feedFixture(t)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/feed.rss?archive=2", nil))
+
+	var doc rssDocument
+	err := xml.Unmarshal(rec.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal("Expected valid xml, got", err)
+	}
+	if doc.Channel.Archive == nil {
+		t.Fatal("Expected archive document to be marked as archive")
+	}
+	if doc.Channel.Items[0].Enclosure.Url != "http://example.com/images/100.gif" || doc.Channel.Items[0].Enclosure.Type != "image/gif" {
+		t.Fatal("Expected enclosure to point to the local media, got", doc.Channel.Items[0].Enclosure)
+	}
+	if !strings.Contains(rec.Body.String(), `rel="prev-archive" href="http://example.com/feed.rss?archive=1"`) {
+		t.Fatal("Expected link to previous archive document")
+	}
+}
+
+func TestAtom(t *testing.T) {
+	s := feedFixture(t)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/feed.atom", nil))
+
+	var doc atomFeed
+	err := xml.Unmarshal(rec.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal("Expected valid xml, got", err)
+	}
+	if doc.Archive != nil {
+		t.Fatal("Expected subscription document not to be marked as archive")
+	}
+	if len(doc.Entries) != perPage || doc.Entries[0].Id != "120" || doc.Entries[0].Updated != "1970-01-01T00:02:00Z" {
+		t.Fatal("Expected newest entries first")
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/feed.atom?archive=5", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatal("Expected status 404 for unknown archive document, got", rec.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package host
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TLSConfig contains the settings for serving the archive via HTTPS
+type TLSConfig struct {
+	// Cert and Key are PEM files of a certificate and its private key
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// SelfSigned creates a certificate for localhost and all local addresses, if no Cert is given.
+	// It is kept in Dir, so browsers only need to accept it once
+	SelfSigned bool   `json:"self_signed"`
+	Dir        string `json:"dir"`
+	// RedirectFrom is the address of a plain HTTP listener redirecting every request to HTTPS, e.g. ":80"
+	RedirectFrom string `json:"redirect_from"`
+}
+
+// selfSignedValidity is how long generated certificates are valid. Expired ones are replaced on start
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// enabled tells whether the archive is served via HTTPS
+func (c TLSConfig) enabled() bool {
+	return c.Cert != "" || c.SelfSigned
+}
+
+// certificate loads the configured certificate or the self signed one, which is created if needed
+func (c TLSConfig) certificate() (tls.Certificate, error) {
+	if c.Cert != "" {
+		return tls.LoadX509KeyPair(c.Cert, c.Key)
+	}
+
+	return selfSignedCertificate(c.Dir, time.Now())
+}
+
+// selfSignedCertificate returns the certificate stored in dir. If there is none or it is expired, a new one is generated
+func selfSignedCertificate(dir string, now time.Time) (tls.Certificate, error) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && now.Before(leaf.NotAfter) {
+			return cert, nil
+		}
+	}
+
+	certPem, keyPem, err := generateCertificate(now)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = ioutil.WriteFile(keyFile, keyPem, 0600)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = ioutil.WriteFile(certFile, certPem, 0644)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair(certPem, keyPem)
+}
+
+// generateCertificate creates a self signed certificate for localhost, the hostname and all addresses of this machine
+func generateCertificate(now time.Time) (certPem []byte, keyPem []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"souparchive"}, CommonName: "souparchive"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok {
+			template.IPAddresses = append(template.IPAddresses, n.IP)
+		}
+	}
+	if len(template.IPAddresses) == 0 {
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error creating certificate: %s", err))
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), nil
+}
+
+// redirectToHttps sends every request to the same url on the HTTPS listener at the given address
+func redirectToHttps(listen string) http.Handler {
+	_, port, _ := net.SplitHostPort(listen)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// contentSecurityPolicy only allows resources of the archive itself. The templates use inline styles but no scripts
+const contentSecurityPolicy = "default-src 'self'; img-src 'self' data:; media-src 'self'; style-src 'self' 'unsafe-inline'; script-src 'none'; object-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+
+// withSecurityHeaders sets security related headers on all responses. HSTS is only sent via HTTPS
+func withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "same-origin")
+		if r.TLS != nil {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
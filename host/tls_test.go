@@ -0,0 +1,85 @@
+package host
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-tls-test")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+
+	cert, err := selfSignedCertificate(dir, now)
+	if err != nil {
+		t.Fatal("Expected certificate to be generated, got", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal("Expected valid certificate, got", err)
+	}
+	if leaf.VerifyHostname("localhost") != nil {
+		t.Fatal("Expected certificate to be valid for localhost, got", leaf.DNSNames)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "key.pem")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatal("Expected private key to be stored readable for the owner only, got", err)
+	}
+
+	again, err := selfSignedCertificate(dir, now.Add(time.Hour))
+	if err != nil || string(again.Certificate[0]) != string(cert.Certificate[0]) {
+		t.Fatal("Expected stored certificate to be reused, got", err)
+	}
+
+	renewed, err := selfSignedCertificate(dir, now.Add(selfSignedValidity+time.Hour))
+	if err != nil || string(renewed.Certificate[0]) == string(cert.Certificate[0]) {
+		t.Fatal("Expected expired certificate to be replaced, got", err)
+	}
+}
+
+func TestRedirectToHttps(t *testing.T) {
+	tests := []struct {
+		listen   string
+		host     string
+		expected string
+	}{
+		{listen: ":443", host: "example.com", expected: "https://example.com/page-2.html?x=1"},
+		{listen: ":8443", host: "example.com:8080", expected: "https://example.com:8443/page-2.html?x=1"},
+		{listen: "192.168.1.2:8443", host: "192.168.1.2", expected: "https://192.168.1.2:8443/page-2.html?x=1"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/page-2.html?x=1", nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		redirectToHttps(test.listen).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != test.expected {
+			t.Fatalf("Expected redirect to %s, got %d %s", test.expected, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := withSecurityHeaders(http.NotFoundHandler())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/", nil))
+	if rec.Header().Get("Content-Security-Policy") == "" || rec.Header().Get("X-Frame-Options") != "DENY" {
+		t.Fatal("Expected security headers, got", rec.Header())
+	}
+	if rec.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatal("Expected no HSTS via plain HTTP")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "https://example.com/", nil))
+	if rec.Header().Get("Strict-Transport-Security") == "" {
+		t.Fatal("Expected HSTS via HTTPS")
+	}
+}
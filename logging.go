@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// newLogger sets up a leveled logger writing text or json to w. In quiet mode only errors are logged
+func newLogger(w io.Writer, format, level string, quiet bool) (*slog.Logger, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unknown log level %s", level))
+	}
+	if quiet {
+		l = slog.LevelError
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown log format %s", format))
+}
@@ -1,18 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/trace"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/bestform/souparchive/client"
 	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/embed"
 	"github.com/bestform/souparchive/feed"
 	"github.com/bestform/souparchive/fetch"
 	"github.com/bestform/souparchive/host"
+	"github.com/bestform/souparchive/metrics"
+	"github.com/bestform/souparchive/phash"
+	"github.com/bestform/souparchive/report"
+	"github.com/bestform/souparchive/sidecar"
+	"github.com/bestform/souparchive/thumb"
 )
 
 // DEBUG will write a trace if set to true. The only way to set this to true is to manipulate this very code
@@ -29,14 +41,57 @@ func main() {
 		defer trace.Stop()
 	}
 
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	flag.Usage = usage
 	accountPtr := flag.String("user", "", "soup.io username")
-	hostLocalArchive := flag.Bool("host", false, "host the local archive on port 8080 (incomplete feature. stay tuned.)")
+	hostLocalArchive := flag.Bool("host", false, "host the local archive on port 8080 or the address given via -listen and -port. Send SIGHUP to reload the archive")
+	configPath := flag.String("config", "", "path to a json configuration file")
+	dryRun := flag.Bool("dry-run", false, "only print what would be downloaded without writing anything")
+	jsonOutput := flag.Bool("json", false, "print the result of -dry-run as json")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	logLevel := flag.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	quiet := flag.Bool("quiet", false, "only log errors. Useful for cron jobs")
+	reportPath := flag.String("report", "", "write a json summary of the run to this file")
+	thumbnails := flag.Bool("thumbnails", false, "generate previews for the hosted archive while archiving")
+	embedMetadata := flag.Bool("embed-metadata", false, "write source url, post link, publish date and caption into JPEG and PNG files and set the modification time of all files to the publish date")
+	linkDuplicates := flag.Bool("link-duplicates", false, "do not keep downloads that look like an already archived image with the same content or dimensions. The item refers to the archived file instead")
+	dupeThreshold := flag.Int("dupe-threshold", phash.DefaultThreshold, "maximum number of differing bits of perceptual hashes for -link-duplicates")
+	videoDownloader := flag.String("video-downloader", "", "command to archive videos from YouTube, Vimeo and other sites, e.g. \"yt-dlp --no-playlist {url}\". {url} is replaced by the url of the video. Videos hosted by soup are downloaded without it")
+	snapshots := flag.Bool("snapshots", false, "archive the pages link posts point to as self-contained html files")
+	sidecars := flag.Bool("sidecars", false, "write a json file with the metadata of each item next to it. Needed for reindex")
+	cf := registerClientFlags(client.DefaultConfig())
+	hf := registerHostFlags()
 	flag.Parse()
 
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *quiet)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		cfg, err = readConfig(*configPath)
+		if err != nil {
+			logger.Error("error reading config", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+	}
+	cf.apply(&cfg.Client)
+	hf.apply(&cfg.Host)
+
 	if *hostLocalArchive {
-		err := host.Host("8080")
+		// SIGINT and SIGTERM stop the host after running requests are finished
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := host.Host(ctx, cfg.Host)
+		stop()
 		if err != nil {
-			fmt.Println(err)
+			logger.Error("error hosting archive", "error", err)
 			os.Exit(1)
 		}
 		os.Exit(0)
@@ -47,55 +102,147 @@ func main() {
 		os.Exit(0)
 	}
 
+	httpClient, err := client.New(cfg.Client)
+	if err != nil {
+		logger.Error("error setting up http client", "error", err)
+		os.Exit(1)
+	}
+	fetch.UseClient(httpClient)
+	fetch.UseSnapshots(*snapshots)
+	if *videoDownloader != "" {
+		fetch.UseVideoDownloader(strings.Fields(*videoDownloader))
+	}
+
+	// the first SIGINT or SIGTERM cancels all running downloads. Finished items are still written to the archive
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r := report.New(*accountPtr)
+
 	url := feed.GetFeedUrlForUsername(*accountPtr)
-	feedResponse, err := http.Get(url)
+	feedStart := time.Now()
+	feedResponse, err := httpClient.Get(ctx, url)
 	if err != nil {
-		fmt.Printf("Error fetching %s: %s", url, err)
+		logger.Error("error fetching feed", "url", url, "error", err)
 		os.Exit(1)
 	}
 	defer feedResponse.Body.Close()
 	feedBody, err := ioutil.ReadAll(feedResponse.Body)
 	if err != nil {
-		fmt.Printf("Error reading rssFeed from %s: %s", url, err)
+		logger.Error("error reading feed", "url", url, "error", err)
 		os.Exit(1)
 	}
+	r.FeedDuration = time.Since(feedStart)
 
 	rssFeed := feed.NewFeedFromXml(feedBody)
 
-	var wg sync.WaitGroup
-
 	a := db.NewArchive("archive/archive.json")
 	a.Read()
 
+	if *dryRun {
+		p := fetch.NewPlan(ctx, rssFeed.Channel.Items, a)
+		err := printPlan(os.Stdout, p, *jsonOutput)
+		if err != nil {
+			logger.Error("error printing plan", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var wg sync.WaitGroup
+
 	c := make(chan db.Item)
+	// items of this run are compared to each other as well
+	known := phash.NewIndex(a.Data.Items)
 
 	for _, i := range rssFeed.Channel.Items {
 		wg.Add(1)
 		go func(i feed.Item, a db.Archive, c chan db.Item) {
 			defer wg.Done()
-			if "" == i.Attributes.Url {
+			source := fetch.Source(i)
+			l := logger.With("guid", i.Guid, "url", source)
+			if "" == source {
 				// some entries do not have a single url to save.
 				// for now we are going to skip those
+				l.Debug("skipping item without url", "outcome", report.Skipped)
+				r.Add(report.ItemResult{Guid: i.Guid, Outcome: report.Skipped})
+				return
+			}
+			if a.Contains(i.Guid) {
+				l.Debug("already archived", "outcome", report.Archived)
+				r.Add(report.ItemResult{Guid: i.Guid, Url: source, Outcome: report.Archived})
 				return
 			}
-			fmt.Printf("Saving %s...\n", i.Attributes.Url)
-			guid, timestamp, filename, err := fetch.Fetch(i, a)
+			start := time.Now()
+			item, err := fetch.Fetch(ctx, i, a)
+			duration := time.Since(start)
 			if err != nil {
-				fmt.Println(err)
+				l.Error("error saving item", "outcome", report.Failed, "duration", duration, "error", err)
+				r.Add(report.ItemResult{Guid: i.Guid, Url: source, Outcome: report.Failed, Duration: duration, Error: err.Error()})
 				return
 			}
-			c <- db.Item{guid, timestamp, filename}
+			item.Account = *accountPtr
+			if hash, err := phash.File(filepath.Join("archive", item.Filename)); err == nil {
+				item.PHash = phash.Format(hash)
+				existing, ok := known.Claim(item, hash, *dupeThreshold)
+				// a close hash alone is no proof, the download is only dropped for the same content or dimensions
+				confirmed := ok && (item.Sha256 == existing.Sha256 || phash.SameSize(filepath.Join("archive", item.Filename), filepath.Join("archive", existing.Filename)))
+				if ok && *linkDuplicates && !confirmed {
+					l.Info("kept unconfirmed near duplicate", "duplicate_of", existing.Guid, "filename", existing.Filename)
+				}
+				if confirmed && *linkDuplicates {
+					if item.Filename != existing.Filename {
+						os.Remove(filepath.Join("archive", item.Filename))
+					}
+					// the new item refers to the archived file, but keeps its own metadata and no annotations
+					linked := item
+					linked.Filename, linked.Size, linked.Sha256, linked.MimeType, linked.PHash, linked.Thumbnail = existing.Filename, existing.Size, existing.Sha256, existing.MimeType, existing.PHash, existing.Thumbnail
+					if *sidecars {
+						err = sidecar.Write("archive", sidecar.New(i, linked))
+						if err != nil {
+							l.Warn("error writing sidecar", "error", err)
+						}
+					}
+					l.Info("linked near duplicate", "outcome", report.Fetched, "duplicate_of", existing.Guid, "filename", existing.Filename, "duration", duration)
+					r.Add(report.ItemResult{Guid: i.Guid, Url: source, Outcome: report.Fetched, Bytes: item.Size, Duration: duration})
+					c <- linked
+					return
+				}
+			}
+			if *embedMetadata {
+				err = embedInto(filepath.Join("archive", item.Filename), i, &item)
+				if err != nil {
+					l.Warn("error embedding metadata", "error", err)
+				}
+			}
+			if *thumbnails {
+				item.Thumbnail, err = thumb.Generate("archive", item.Filename, thumb.DefaultWidth)
+				if err != nil {
+					l.Warn("error generating thumbnail", "error", err)
+				}
+			}
+			if *sidecars {
+				err = sidecar.Write("archive", sidecar.New(i, item))
+				if err != nil {
+					l.Warn("error writing sidecar", "error", err)
+				}
+			}
+			l.Info("saved item", "outcome", report.Fetched, "bytes", item.Size, "duration", duration, "filename", item.Filename)
+			r.Add(report.ItemResult{Guid: i.Guid, Url: source, Outcome: report.Fetched, Bytes: item.Size, Duration: duration})
+			c <- item
 		}(i, a, c)
 	}
 
 	waitForArchive := make(chan bool)
 	go func(c chan db.Item) {
+		// the downloads still read a, so the archive is re-read into an archive of its own
+		p := db.NewArchive(a.Path)
 		for item := range c {
-			a.Read()
-			a.Add(item.Guid, item.Timestamp, item.Filename)
-			err := a.Persist()
+			p.Read()
+			p.AddItem(item)
+			err := p.Persist()
 			if err != nil {
-				fmt.Println("error persisting database", err)
+				logger.Error("error persisting database", "error", err)
 			}
 		}
 		waitForArchive <- true
@@ -104,4 +251,43 @@ func main() {
 	wg.Wait()
 	close(c)
 	<-waitForArchive
+
+	r.Finish(ctx.Err() != nil)
+	logger.Info("run finished", "fetched", r.Fetched, "failed", r.Failed, "skipped", r.Skipped, "archived", r.Archived, "bytes", r.Bytes, "duration", r.Finished.Sub(r.Started))
+	m := metrics.NewStore("archive/metrics.json")
+	m.Read()
+	m.Record(r)
+	err = m.Persist()
+	if err != nil {
+		logger.Error("error persisting metrics", "error", err)
+	}
+	if *reportPath != "" {
+		err := r.Write(*reportPath)
+		if err != nil {
+			logger.Error("error writing report", "path", *reportPath, "error", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		logger.Warn("interrupted. All finished downloads have been saved to the archive")
+		stop()
+		os.Exit(130)
+	}
+}
+
+// embedInto writes the metadata of the feed item into the archived file and updates size and checksum of the db item accordingly
+func embedInto(path string, i feed.Item, item *db.Item) error {
+	err := embed.File(path, embed.Metadata{
+		SourceUrl: item.SourceUrl,
+		Link:      i.Link,
+		Caption:   i.Title,
+		Published: i.PubDate.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	item.Size, item.Sha256, err = db.FileChecksum(path)
+
+	return err
 }
@@ -0,0 +1,149 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/sidecar"
+)
+
+// Conflict describes a guid that is archived with different content in two archives. The first one merged is kept
+type Conflict struct {
+	Guid          string
+	Kept          string
+	KeptSha256    string
+	Dropped       string
+	DroppedSha256 string
+}
+
+// Result summarizes a merge
+type Result struct {
+	// Added is the number of items copied into the target
+	Added int
+	// DuplicateGuid is the number of items whose guid was already in the target with the same content
+	DuplicateGuid int
+	// DuplicateContent is the number of items whose content was already in the target under another guid.
+	// They are added to the target sharing the existing file
+	DuplicateContent int
+	// Renamed is the number of files that got a new name because theirs was already taken
+	Renamed   int
+	Conflicts []Conflict
+}
+
+// Merge combines the archives in the source directories into the archive in target, which may already contain items.
+// Items are deduplicated by guid and by sha256 of their content. If the merge fails, the files copied so far are removed again
+func Merge(target string, sources []string) (r Result, err error) {
+	var copied []string
+	defer func() {
+		if err != nil {
+			for _, f := range copied {
+				os.Remove(f)
+			}
+		}
+	}()
+
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		return r, err
+	}
+	a := db.NewArchive(filepath.Join(target, "archive.json"))
+	a.Read()
+
+	byGuid := map[string]db.Item{}
+	bySha := map[string]db.Item{}
+	for n, i := range a.Data.Items {
+		if i.Sha256 == "" {
+			_, sha, err := db.FileChecksum(filepath.Join(target, i.Filename))
+			if err != nil {
+				return r, errors.New(fmt.Sprintf("Error reading %s: %s", i.Filename, err))
+			}
+			a.Data.Items[n].Sha256 = sha
+			i.Sha256 = sha
+		}
+		byGuid[i.Guid] = i
+		bySha[i.Sha256] = i
+	}
+
+	for _, source := range sources {
+		s := db.NewArchive(filepath.Join(source, "archive.json"))
+		s.Read()
+		for _, i := range s.Data.Items {
+			src := filepath.Join(source, i.Filename)
+			size, sha, err := db.FileChecksum(src)
+			if err != nil {
+				return r, errors.New(fmt.Sprintf("Error reading %s: %s", src, err))
+			}
+			i.Size, i.Sha256 = size, sha
+
+			if existing, ok := byGuid[i.Guid]; ok {
+				if existing.Sha256 == sha {
+					r.DuplicateGuid++
+				} else {
+					r.Conflicts = append(r.Conflicts, Conflict{
+						Guid:          i.Guid,
+						Kept:          filepath.Join(target, existing.Filename),
+						KeptSha256:    existing.Sha256,
+						Dropped:       src,
+						DroppedSha256: sha,
+					})
+				}
+				continue
+			}
+
+			if existing, ok := bySha[sha]; ok {
+				i.Filename, i.Thumbnail = existing.Filename, existing.Thumbnail
+				r.DuplicateContent++
+			} else {
+				name := db.FreeFilename(target, i.Filename, nil)
+				if name != i.Filename {
+					r.Renamed++
+				}
+				err := copyFile(src, filepath.Join(target, name))
+				if err != nil {
+					return r, err
+				}
+				copied = append(copied, filepath.Join(target, name))
+				if sc, err := sidecar.Read(source, i.Filename); err == nil {
+					sc.Filename = name
+					if sidecar.Write(target, sc) == nil {
+						copied = append(copied, filepath.Join(target, name+sidecar.Suffix))
+					}
+				}
+				i.Filename, i.Thumbnail = name, ""
+				r.Added++
+			}
+
+			a.AddItem(i)
+			byGuid[i.Guid] = i
+			bySha[sha] = i
+		}
+	}
+
+	return r, a.Persist()
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return out.Close()
+}
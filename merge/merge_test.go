@@ -0,0 +1,100 @@
+package merge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+type testFile struct {
+	guid, filename, content string
+}
+
+func tempArchive(t *testing.T, dir string, files []testFile) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal("Could not create temp dir. Error in test!", err)
+	}
+	a := db.NewArchive(filepath.Join(dir, "archive.json"))
+	for n, f := range files {
+		ioutil.WriteFile(filepath.Join(dir, f.filename), []byte(f.content), 0644)
+		a.Add(f.guid, int64(n), f.filename)
+	}
+	a.Persist()
+}
+
+func TestMerge(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-merge-test")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	tempArchive(t, filepath.Join(dir, "alice"), []testFile{
+		{"1", "a.gif", "first"},
+		{"2", "b.gif", "second"},
+	})
+	tempArchive(t, filepath.Join(dir, "bob"), []testFile{
+		// same guid, same content
+		{"1", "a-copy.gif", "first"},
+		// same guid, different content
+		{"2", "b.gif", "other"},
+		// repost of the same content
+		{"3", "c.gif", "first"},
+		// new item with a taken filename
+		{"4", "a.gif", "fourth"},
+	})
+
+	target := filepath.Join(dir, "merged")
+	r, err := Merge(target, []string{filepath.Join(dir, "alice"), filepath.Join(dir, "bob")})
+	if err != nil {
+		t.Fatal("Expected archives to be merged, got", err)
+	}
+
+	if r.Added != 3 || r.DuplicateGuid != 1 || r.DuplicateContent != 1 || r.Renamed != 1 {
+		t.Fatalf("Wrong result: added %d, duplicate guid %d, duplicate content %d, renamed %d", r.Added, r.DuplicateGuid, r.DuplicateContent, r.Renamed)
+	}
+	if len(r.Conflicts) != 1 || r.Conflicts[0].Guid != "2" {
+		t.Fatal("Expected one conflict for guid 2, got", r.Conflicts)
+	}
+
+	a := db.NewArchive(filepath.Join(target, "archive.json"))
+	a.Read()
+	if len(a.Data.Items) != 4 {
+		t.Fatal("Expected 4 items in merged archive, got", len(a.Data.Items))
+	}
+	files := map[string]string{}
+	for _, i := range a.Data.Items {
+		files[i.Guid] = i.Filename
+	}
+	if files["3"] != "a.gif" {
+		t.Fatal("Expected repost to share the file of guid 1, got", files["3"])
+	}
+	if files["4"] != "a-1.gif" {
+		t.Fatal("Expected colliding filename to be renamed, got", files["4"])
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(target, "a-1.gif"))
+	if string(data) != "fourth" {
+		t.Fatal("Expected renamed file to contain 'fourth', got", string(data))
+	}
+}
+
+func TestFailedMergeRemovesCopiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	tempArchive(t, filepath.Join(dir, "alice"), []testFile{{"1", "a.gif", "first"}})
+	tempArchive(t, filepath.Join(dir, "bob"), []testFile{{"2", "b.gif", "second"}})
+	os.Remove(filepath.Join(dir, "bob", "b.gif"))
+
+	target := filepath.Join(dir, "target")
+	_, err := Merge(target, []string{filepath.Join(dir, "alice"), filepath.Join(dir, "bob")})
+	if err == nil {
+		t.Fatal("Expected error on missing file, got nil")
+	}
+	if _, err := os.Stat(filepath.Join(target, "a.gif")); !os.IsNotExist(err) {
+		t.Fatal("Expected copied file to be removed after the failed merge, got", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "archive.json")); !os.IsNotExist(err) {
+		t.Fatal("Expected no archive to be written, got", err)
+	}
+}
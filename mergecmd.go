@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/bestform/souparchive/merge"
+)
+
+// mergeArchives combines several archive directories into one
+func mergeArchives(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	into := fs.String("into", "archive", "archive directory to merge into")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: merge [-into dir] archive...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	r, err := merge.Merge(*into, fs.Args())
+	if err != nil {
+		fmt.Println("Error merging archives:", err)
+		return 1
+	}
+
+	fmt.Printf("Added %d items, skipped %d duplicate guids, linked %d items to files already in the archive, renamed %d files\n", r.Added, r.DuplicateGuid, r.DuplicateContent, r.Renamed)
+	for _, c := range r.Conflicts {
+		fmt.Printf("Conflict for guid %s: kept %s (%s), dropped %s (%s)\n", c.Guid, c.Kept, c.KeptSha256, c.Dropped, c.DroppedSha256)
+	}
+	if len(r.Conflicts) > 0 {
+		return 3
+	}
+
+	return 0
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/report"
+)
+
+// Account holds the accumulated numbers of all runs for one account
+type Account struct {
+	Fetched  int64 `json:"fetched"`
+	Failed   int64 `json:"failed"`
+	Skipped  int64 `json:"skipped"`
+	Archived int64 `json:"archived"`
+	Bytes    int64 `json:"bytes"`
+	// FeedPollSeconds is the time it took to download the feed in the latest run
+	FeedPollSeconds float64 `json:"feed_poll_seconds"`
+	// LastSuccess is the unix time of the end of the latest run that has not been interrupted
+	LastSuccess int64 `json:"last_success"`
+}
+
+// Store represents the location and the data of the metrics collected over all runs
+type Store struct {
+	Path     string
+	Accounts map[string]Account
+}
+
+// NewStore will create a new Store struct with the given path
+func NewStore(path string) Store {
+	return Store{Path: path, Accounts: map[string]Account{}}
+}
+
+// Read will refresh the data included in the store from the set path
+func (s *Store) Read() {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return
+	}
+
+	accounts := map[string]Account{}
+	err = json.Unmarshal(data, &accounts)
+	if err != nil {
+		return
+	}
+	s.Accounts = accounts
+}
+
+// Record adds the numbers of a finished run to the store. Keep in mind that this is only in memory until Persist() is called
+func (s *Store) Record(r *report.Report) {
+	a := s.Accounts[r.Account]
+	a.Fetched += int64(r.Fetched)
+	a.Failed += int64(r.Failed)
+	a.Skipped += int64(r.Skipped)
+	a.Archived += int64(r.Archived)
+	a.Bytes += r.Bytes
+	a.FeedPollSeconds = r.FeedDuration.Seconds()
+	if !r.Interrupted {
+		a.LastSuccess = r.Finished.Unix()
+	}
+	s.Accounts[r.Account] = a
+}
+
+// Persist will write the current data to the disk at the given path
+func (s *Store) Persist() error {
+	err := os.MkdirAll(filepath.Dir(s.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s.Accounts)
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.Path)
+}
+
+// Write renders the store and the size of the archive in the prometheus text exposition format
+func Write(w io.Writer, s Store, a db.Archive) {
+	accounts := make([]string, 0, len(s.Accounts))
+	for name := range s.Accounts {
+		accounts = append(accounts, name)
+	}
+	sort.Strings(accounts)
+
+	perAccount := []struct {
+		name, kind, help string
+		value            func(Account) string
+	}{
+		{"souparchive_items_fetched_total", "counter", "Items downloaded and added to the archive.", func(a Account) string { return fmt.Sprint(a.Fetched) }},
+		{"souparchive_items_failed_total", "counter", "Items that could not be downloaded.", func(a Account) string { return fmt.Sprint(a.Failed) }},
+		{"souparchive_items_skipped_total", "counter", "Items without a single url to archive.", func(a Account) string { return fmt.Sprint(a.Skipped) }},
+		{"souparchive_items_already_archived_total", "counter", "Items found in the feed that had already been archived.", func(a Account) string { return fmt.Sprint(a.Archived) }},
+		{"souparchive_bytes_downloaded_total", "counter", "Bytes of media downloaded.", func(a Account) string { return fmt.Sprint(a.Bytes) }},
+		{"souparchive_feed_poll_duration_seconds", "gauge", "Time it took to download the feed in the latest run.", func(a Account) string { return fmt.Sprint(a.FeedPollSeconds) }},
+		{"souparchive_last_success_timestamp_seconds", "gauge", "Unix time of the latest run that has not been interrupted.", func(a Account) string { return fmt.Sprint(a.LastSuccess) }},
+	}
+	for _, m := range perAccount {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, name := range accounts {
+			fmt.Fprintf(w, "%s{account=\"%s\"} %s\n", m.name, escapeLabel(name), m.value(s.Accounts[name]))
+		}
+	}
+
+	var bytes int64
+	for _, i := range a.Data.Items {
+		bytes += i.Size
+	}
+	var dbFileBytes int64
+	if info, err := os.Stat(a.Path); err == nil {
+		dbFileBytes = info.Size()
+	}
+	fmt.Fprintf(w, "# HELP souparchive_db_items Items in the archive.\n# TYPE souparchive_db_items gauge\nsouparchive_db_items %d\n", len(a.Data.Items))
+	fmt.Fprintf(w, "# HELP souparchive_db_media_bytes Size of all archived media.\n# TYPE souparchive_db_media_bytes gauge\nsouparchive_db_media_bytes %d\n", bytes)
+	fmt.Fprintf(w, "# HELP souparchive_db_file_bytes Size of the archive index %s.\n# TYPE souparchive_db_file_bytes gauge\nsouparchive_db_file_bytes %d\n", filepath.Base(a.Path), dbFileBytes)
+}
+
+// escapeLabel escapes a label value as required by the exposition format
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/report"
+)
+
+func TestRecordAccumulatesRuns(t *testing.T) {
+	s := NewStore(filepath.Join(os.TempDir(), "metrics.json"))
+
+	r := report.New("foo")
+	r.Add(report.ItemResult{Outcome: report.Fetched, Bytes: 10})
+	r.Add(report.ItemResult{Outcome: report.Failed})
+	r.FeedDuration = 2 * time.Second
+	r.Finish(false)
+	s.Record(r)
+
+	r = report.New("foo")
+	r.Add(report.ItemResult{Outcome: report.Fetched, Bytes: 5})
+	r.Finish(true)
+	s.Record(r)
+
+	a := s.Accounts["foo"]
+	if a.Fetched != 2 || a.Failed != 1 || a.Bytes != 15 {
+		t.Fatalf("Wrong accumulated numbers: fetched %d, failed %d, bytes %d", a.Fetched, a.Failed, a.Bytes)
+	}
+	if a.LastSuccess == 0 {
+		t.Fatal("Expected last success to be set by the first run")
+	}
+	if a.FeedPollSeconds != 0 {
+		t.Fatal("Expected feed poll time of the latest run, got", a.FeedPollSeconds)
+	}
+}
+
+func TestPersistAndReadStore(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "metrics.json")
+	s := NewStore(path)
+	s.Accounts["foo"] = Account{Fetched: 3}
+	err := s.Persist()
+	if err != nil {
+		t.Fatal("Expected store to be persisted, got", err)
+	}
+
+	read := NewStore(path)
+	read.Read()
+	if read.Accounts["foo"].Fetched != 3 {
+		t.Fatal("Expected 3 fetched items after reading, got", read.Accounts["foo"].Fetched)
+	}
+}
+
+func TestWriteExpositionFormat(t *testing.T) {
+	s := NewStore("")
+	s.Accounts["foo"] = Account{Fetched: 3, LastSuccess: 100}
+	a := db.NewArchive("../db/fixtures/archive.json")
+	a.Read()
+
+	var buf bytes.Buffer
+	Write(&buf, s, a)
+	out := buf.String()
+
+	for _, expected := range []string{
+		"# TYPE souparchive_items_fetched_total counter\n",
+		"souparchive_items_fetched_total{account=\"foo\"} 3\n",
+		"souparchive_last_success_timestamp_seconds{account=\"foo\"} 100\n",
+		"souparchive_db_items 2\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+}
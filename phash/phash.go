@@ -0,0 +1,235 @@
+package phash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register gif decoding for soup's animations
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// DefaultThreshold is the maximum number of differing bits for two images to count as near duplicates
+const DefaultThreshold = 5
+
+// minBits is the minimum number of set and of unset bits of a hash telling anything about the image. Flat images
+// like solid colours or blank frames hash to 0 or close to it and would all count as near duplicates of each other
+const minBits = 4
+
+// Hash computes the difference hash of the image. The image is scaled down to 9x8 gray pixels and every bit
+// tells whether a pixel is brighter than its right neighbour. Reposts in other sizes or qualities produce the same or a close hash
+func Hash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	var gray [h][w]uint64
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 == x0 {
+				x1++
+			}
+			var sum, n uint64
+			for sy := y0; sy < y1 && sy < b.Max.Y; sy++ {
+				for sx := x0; sx < x1 && sx < b.Max.X; sx++ {
+					r, g, bl, _ := img.At(sx, sy).RGBA()
+					sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(bl)) / 1000
+					n++
+				}
+			}
+			if n > 0 {
+				gray[y][x] = sum / n
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// File computes the hash of the image at the given path. For animated gifs the first frame is used
+func File(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Error decoding %s: %s", path, err))
+	}
+
+	return Hash(img), nil
+}
+
+// SameSize tells whether both files are images of the same width and height
+func SameSize(a, b string) bool {
+	ca, err := config(a)
+	if err != nil {
+		return false
+	}
+	cb, err := config(b)
+	if err != nil {
+		return false
+	}
+
+	return ca.Width == cb.Width && ca.Height == cb.Height
+}
+
+// config decodes the dimensions of the image at the given path
+func config(path string) (image.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer f.Close()
+
+	c, _, err := image.DecodeConfig(f)
+	return c, err
+}
+
+// Format renders the hash as it is stored in db.Item
+func Format(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Parse reads a hash as stored in db.Item
+func Parse(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Distance is the number of differing bits of two hashes
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Informative tells whether the hash has enough structure to compare images by it
+func Informative(hash uint64) bool {
+	n := bits.OnesCount64(hash)
+	return n >= minBits && n <= 64-minBits
+}
+
+// Closest returns the item with the hash closest to the given one, if its distance is within the threshold.
+// Hashes that are not Informative never match
+func Closest(items []db.Item, hash uint64, threshold int) (db.Item, bool) {
+	best, found := db.Item{}, false
+	if !Informative(hash) {
+		return best, found
+	}
+	bestDistance := threshold + 1
+	for _, i := range items {
+		h, err := Parse(i.PHash)
+		if i.PHash == "" || err != nil || !Informative(h) {
+			continue
+		}
+		if d := Distance(h, hash); d < bestDistance {
+			best, found, bestDistance = i, true, d
+		}
+	}
+
+	return best, found
+}
+
+// Clusters groups all items with an Informative hash into clusters of near duplicates. Items without near duplicates
+// are left out. Items sharing the same file are treated as one
+func Clusters(items []db.Item, threshold int) [][]db.Item {
+	var hashed []db.Item
+	var hashes []uint64
+	seen := map[string]bool{}
+	for _, i := range items {
+		h, err := Parse(i.PHash)
+		if i.PHash == "" || err != nil || !Informative(h) || seen[i.Filename] {
+			continue
+		}
+		seen[i.Filename] = true
+		hashed = append(hashed, i)
+		hashes = append(hashes, h)
+	}
+
+	// union find over all pairs within the threshold
+	parent := make([]int, len(hashed))
+	for n := range parent {
+		parent[n] = n
+	}
+	var find func(int) int
+	find = func(n int) int {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+	for a := range hashed {
+		for b := a + 1; b < len(hashed); b++ {
+			if Distance(hashes[a], hashes[b]) <= threshold {
+				parent[find(a)] = find(b)
+			}
+		}
+	}
+
+	groups := map[int][]db.Item{}
+	var roots []int
+	for n, i := range hashed {
+		root := find(n)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters [][]db.Item
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+
+	return clusters
+}
+
+// Index finds near duplicates among archived items and items archived while it is in use. It is safe for concurrent use
+type Index struct {
+	lock  sync.Mutex
+	items []db.Item
+}
+
+// NewIndex creates an index of a copy of the given items
+func NewIndex(items []db.Item) *Index {
+	return &Index{items: append([]db.Item(nil), items...)}
+}
+
+// Claim returns the closest near duplicate of the item with the given hash. If there is none, the item is added to
+// the index, so later items are compared to it as well. Lookup and adding happen at once, so of two near duplicates
+// claimed at the same time one always finds the other
+func (x *Index) Claim(item db.Item, hash uint64, threshold int) (db.Item, bool) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if existing, ok := Closest(x.items, hash, threshold); ok {
+		return existing, true
+	}
+	item.PHash = Format(hash)
+	x.items = append(x.items, item)
+
+	return db.Item{}, false
+}
@@ -0,0 +1,127 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// gradient produces an image getting brighter from left to right with a dark square in the middle
+func gradient(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if x > w/3 && x < 2*w/3 && y > h/3 && y < 2*h/3 {
+				v = 0
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+
+	return img
+}
+
+func TestResizedImagesHaveCloseHashes(t *testing.T) {
+	a := Hash(gradient(900, 800))
+	b := Hash(gradient(450, 400))
+	if d := Distance(a, b); d > DefaultThreshold {
+		t.Fatal("Expected resized image to be a near duplicate, got distance", d)
+	}
+
+	inverted := image.NewRGBA(image.Rect(0, 0, 900, 800))
+	src := gradient(900, 800)
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 900; x++ {
+			r, _, _, _ := src.At(899-x, y).RGBA()
+			inverted.Set(x, y, color.RGBA{uint8(r >> 8), uint8(r >> 8), uint8(r >> 8), 255})
+		}
+	}
+	if d := Distance(a, Hash(inverted)); d <= DefaultThreshold {
+		t.Fatal("Expected mirrored image to be different, got distance", d)
+	}
+}
+
+func TestFormatAndParse(t *testing.T) {
+	h, err := Parse(Format(0xf0f0))
+	if err != nil || h != 0xf0f0 {
+		t.Fatal("Expected hash to survive formatting, got", h, err)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	items := []db.Item{
+		{Guid: "1", Filename: "a.gif", PHash: Format(0xff00)},
+		{Guid: "2", Filename: "b.gif", PHash: Format(0xff01)},
+		{Guid: "3", Filename: "c.gif", PHash: Format(0x00ff)},
+		{Guid: "4", Filename: "d.gif", PHash: Format(0xff03)},
+		{Guid: "5", Filename: "e.mp4"},
+		// shares the file of guid 3
+		{Guid: "6", Filename: "c.gif", PHash: Format(0x00ff)},
+	}
+
+	clusters := Clusters(items, 2)
+	if len(clusters) != 1 {
+		t.Fatal("Expected one cluster, got", len(clusters))
+	}
+	if len(clusters[0]) != 3 || clusters[0][0].Guid != "1" || clusters[0][2].Guid != "4" {
+		t.Fatal("Expected cluster of guids 1, 2 and 4, got", clusters[0])
+	}
+}
+
+func TestClosest(t *testing.T) {
+	items := []db.Item{
+		{Guid: "1", PHash: Format(0xff00)},
+		{Guid: "2", PHash: Format(0xff01)},
+	}
+
+	i, ok := Closest(items, 0xff03, 2)
+	if !ok || i.Guid != "2" {
+		t.Fatal("Expected guid 2 to be closest, got", i.Guid, ok)
+	}
+	if _, ok := Closest(items, 0x00ff, 2); ok {
+		t.Fatal("Expected no item within threshold")
+	}
+}
+
+func TestFlatImagesAreNoDuplicates(t *testing.T) {
+	flat := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	h := Hash(flat)
+	if Informative(h) {
+		t.Fatal("Expected hash of a flat image not to be informative, got", Format(h))
+	}
+	if !Informative(Hash(gradient(900, 800))) {
+		t.Fatal("Expected hash of the gradient to be informative")
+	}
+
+	items := []db.Item{{Guid: "1", PHash: Format(0)}, {Guid: "2", PHash: Format(0xff00)}}
+	if i, ok := Closest(items, 0, DefaultThreshold); ok {
+		t.Fatal("Expected flat images not to match, got", i.Guid)
+	}
+	if i, ok := Closest(items, 0xff01, 2); !ok || i.Guid != "2" {
+		t.Fatal("Expected guid 2 to be closest, got", i.Guid, ok)
+	}
+	if clusters := Clusters([]db.Item{items[0], {Guid: "3", Filename: "c.gif", PHash: Format(1)}}, DefaultThreshold); len(clusters) != 0 {
+		t.Fatal("Expected no clusters of flat images, got", clusters)
+	}
+}
+
+func TestIndexFindsItemsClaimedBefore(t *testing.T) {
+	archived := []db.Item{{Guid: "1", PHash: Format(0xff00)}}
+	x := NewIndex(archived)
+
+	if i, ok := x.Claim(db.Item{Guid: "2"}, 0xff01, 2); !ok || i.Guid != "1" {
+		t.Fatal("Expected archived guid 1 to be found, got", i.Guid, ok)
+	}
+	if _, ok := x.Claim(db.Item{Guid: "3"}, 0x00ff, 2); ok {
+		t.Fatal("Expected no near duplicate of guid 3")
+	}
+	if i, ok := x.Claim(db.Item{Guid: "4"}, 0x01ff, 2); !ok || i.Guid != "3" {
+		t.Fatal("Expected guid 3 claimed before to be found, got", i.Guid, ok)
+	}
+	if len(archived) != 1 {
+		t.Fatal("Expected the archived items to be untouched, got", len(archived))
+	}
+}
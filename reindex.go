@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/sidecar"
+)
+
+// reindex rebuilds archive.json from the sidecars. An existing archive.json is kept as archive.json.bak, or
+// archive.json-1.bak and so on if earlier backups exist.
+// Tags, annotations and collections are not part of the sidecars, so they are taken over from it
+func reindex(args []string) int {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory containing the files and their sidecars")
+	fs.Parse(args)
+
+	items, errs := sidecar.Reindex(*dir)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(items) == 0 {
+		// never replace an archive with an empty one
+		fmt.Println("No sidecars found in", *dir)
+		return 1
+	}
+
+	a := db.NewArchive(*dir + "/archive.json")
+	old := db.NewArchive(a.Path)
+	old.Read()
+	annotated := map[string]db.Item{}
+	for _, i := range old.Data.Items {
+		annotated[i.Guid] = i
+	}
+	a.Data.Collections = old.Data.Collections
+
+	if _, err := os.Stat(a.Path); err == nil {
+		backup := filepath.Join(*dir, db.FreeFilename(*dir, "archive.json.bak", nil))
+		err = os.Rename(a.Path, backup)
+		if err != nil {
+			fmt.Println("Error backing up archive:", err)
+			return 1
+		}
+		fmt.Println("Kept previous archive as", backup)
+	}
+	for _, i := range items {
+		if o, ok := annotated[i.Guid]; ok {
+			i.Tags, i.Favorite, i.Note, i.Rating = o.Tags, o.Favorite, o.Note, o.Rating
+		}
+		a.AddItem(i)
+	}
+	err := a.Persist()
+	if err != nil {
+		fmt.Println("Error persisting archive:", err)
+		return 1
+	}
+	fmt.Printf("Rebuilt %s with %d items\n", a.Path, len(items))
+
+	return 0
+}
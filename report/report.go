@@ -0,0 +1,96 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of processing a single feed item
+type Outcome string
+
+const (
+	// Fetched means the item has been downloaded and added to the archive
+	Fetched Outcome = "fetched"
+	// Failed means downloading the item did not succeed
+	Failed Outcome = "failed"
+	// Skipped means the item can not be archived, e.g. because it has no single url
+	Skipped Outcome = "skipped"
+	// Archived means the item has already been part of the archive
+	Archived Outcome = "archived"
+)
+
+// ItemResult describes what happened to a single feed item during a run
+type ItemResult struct {
+	Guid     string        `json:"guid"`
+	Url      string        `json:"url"`
+	Outcome  Outcome       `json:"outcome"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report summarizes a complete run. It is safe to add results from several goroutines
+type Report struct {
+	mu sync.Mutex
+
+	Account     string    `json:"account"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Interrupted bool      `json:"interrupted"`
+	// FeedDuration is the time it took to download the feed
+	FeedDuration time.Duration `json:"feed_duration_ns"`
+	Fetched      int           `json:"fetched"`
+	Failed       int           `json:"failed"`
+	Skipped      int           `json:"skipped"`
+	Archived     int           `json:"archived"`
+	Bytes        int64         `json:"bytes"`
+	Items        []ItemResult  `json:"items"`
+}
+
+// New starts the report for a run on the given account
+func New(account string) *Report {
+	return &Report{Account: account, Started: time.Now(), Items: []ItemResult{}}
+}
+
+// Add records the result of a single item
+func (r *Report) Add(i ItemResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch i.Outcome {
+	case Fetched:
+		r.Fetched++
+		r.Bytes += i.Bytes
+	case Failed:
+		r.Failed++
+	case Skipped:
+		r.Skipped++
+	case Archived:
+		r.Archived++
+	}
+	r.Items = append(r.Items, i)
+}
+
+// Finish marks the end of the run
+func (r *Report) Finish(interrupted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Finished = time.Now()
+	r.Interrupted = interrupted
+}
+
+// Write stores the report as json at the given path
+func (r *Report) Write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
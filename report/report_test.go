@@ -0,0 +1,53 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddCountsOutcomes(t *testing.T) {
+	r := New("foo")
+	r.Add(ItemResult{Guid: "1", Outcome: Fetched, Bytes: 10})
+	r.Add(ItemResult{Guid: "2", Outcome: Fetched, Bytes: 20})
+	r.Add(ItemResult{Guid: "3", Outcome: Failed, Error: "Status 404"})
+	r.Add(ItemResult{Guid: "4", Outcome: Skipped})
+	r.Add(ItemResult{Guid: "5", Outcome: Archived})
+
+	if r.Fetched != 2 || r.Failed != 1 || r.Skipped != 1 || r.Archived != 1 {
+		t.Fatalf("Wrong counts: fetched %d, failed %d, skipped %d, archived %d", r.Fetched, r.Failed, r.Skipped, r.Archived)
+	}
+	if r.Bytes != 30 {
+		t.Fatal("Expected 30 bytes, got", r.Bytes)
+	}
+	if len(r.Items) != 5 {
+		t.Fatal("Expected 5 items in report, got", len(r.Items))
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "report.json")
+
+	r := New("foo")
+	r.Add(ItemResult{Guid: "1", Outcome: Fetched, Bytes: 10})
+	r.Finish(false)
+	err := r.Write(path)
+	if err != nil {
+		t.Fatal("Expected report to be written, got", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("Could not read report. Error in test!", err)
+	}
+	var read Report
+	err = json.Unmarshal(data, &read)
+	if err != nil {
+		t.Fatal("Expected report to be valid json, got", err)
+	}
+	if read.Account != "foo" || read.Fetched != 1 || len(read.Items) != 1 {
+		t.Fatalf("Report not written correctly: account %s, fetched %d, items %d", read.Account, read.Fetched, len(read.Items))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// selection holds the flags commands use to pick items of the archive
+type selection struct {
+	guids stringList
+	query *string
+	from  *string
+	to    *string
+}
+
+// registerSelectionFlags defines the flags for picking items on the given flag set
+func registerSelectionFlags(fs *flag.FlagSet) *selection {
+	s := &selection{
+		query: fs.String("q", "", "select items whose guid, filename or tags contain this text"),
+		from:  fs.String("from", "", "select items published on or after this date (2017-02-24)"),
+		to:    fs.String("to", "", "select items published on or before this date (2017-02-24)"),
+	}
+	fs.Var(&s.guids, "guid", "select the item with this guid. Can be given several times")
+
+	return s
+}
+
+// empty tells whether no item has been selected explicitly
+func (s *selection) empty() bool {
+	return len(s.guids) == 0 && *s.query == "" && *s.from == "" && *s.to == ""
+}
+
+// match returns the guids of all selected items. All given criteria have to match
+func (s *selection) match(items []db.Item) ([]string, error) {
+	from, err := selectionDate(*s.from, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := selectionDate(*s.to, true)
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(*s.query)
+
+	var guids []string
+	for _, i := range items {
+		if len(s.guids) > 0 && !contains(s.guids, i.Guid) {
+			continue
+		}
+		if !from.IsZero() && i.Timestamp < from.Unix() {
+			continue
+		}
+		if !to.IsZero() && i.Timestamp > to.Unix() {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(i.Guid), query) && !strings.Contains(strings.ToLower(i.Filename), query) && !contains(i.Tags, db.Slug(query)) {
+			continue
+		}
+		guids = append(guids, i.Guid)
+	}
+
+	return guids, nil
+}
+
+// selectionDate parses a date. The end of a range includes the whole day
+func selectionDate(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return t, errors.New(fmt.Sprintf("Invalid date %s, expected e.g. 2017-02-24", v))
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+
+	return t, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
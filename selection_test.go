@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+)
+
+func TestSelectionMatch(t *testing.T) {
+	day := func(date string, hour int) int64 {
+		d, _ := time.Parse("2006-01-02", date)
+		return d.Add(time.Duration(hour) * time.Hour).Unix()
+	}
+	items := []db.Item{
+		{Guid: "http://foo.soup.io/post/1", Timestamp: day("2017-02-23", 12), Filename: "cat.gif", Tags: []string{"cats"}},
+		{Guid: "http://foo.soup.io/post/2", Timestamp: day("2017-02-24", 0), Filename: "dog.png"},
+		{Guid: "http://foo.soup.io/post/3", Timestamp: day("2017-02-24", 23), Filename: "b.mp4", Tags: []string{"funny-videos"}},
+		{Guid: "http://foo.soup.io/post/4", Timestamp: day("2017-02-25", 0), Filename: "c.jpg"},
+	}
+
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "1,2,3,4"},
+		{[]string{"-guid", "http://foo.soup.io/post/2", "-guid", "http://foo.soup.io/post/4"}, "2,4"},
+		{[]string{"-q", "DOG"}, "2"},
+		{[]string{"-q", "cats"}, "1"},
+		{[]string{"-q", "Funny Videos"}, "3"},
+		{[]string{"-q", "post/"}, "1,2,3,4"},
+		{[]string{"-from", "2017-02-24"}, "2,3,4"},
+		{[]string{"-to", "2017-02-24"}, "1,2,3"},
+		{[]string{"-from", "2017-02-24", "-to", "2017-02-24"}, "2,3"},
+		{[]string{"-from", "2017-02-24", "-q", "c"}, "4"},
+		{[]string{"-guid", "http://foo.soup.io/post/1", "-from", "2017-02-24"}, ""},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		sel := registerSelectionFlags(fs)
+		fs.Parse(test.args)
+
+		guids, err := sel.match(items)
+		if err != nil {
+			t.Fatal("Expected selection to match, got", err)
+		}
+		var matched []string
+		for _, g := range guids {
+			matched = append(matched, strings.TrimPrefix(g, "http://foo.soup.io/post/"))
+		}
+		if strings.Join(matched, ",") != test.expected {
+			t.Fatalf("Expected %v to select %s, got %s", test.args, test.expected, strings.Join(matched, ","))
+		}
+	}
+}
+
+func TestSelectionInvalidDate(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	sel := registerSelectionFlags(fs)
+	fs.Parse([]string{"-to", "24.02.2017"})
+
+	if _, err := sel.match(nil); err == nil {
+		t.Fatal("Expected invalid date to be rejected")
+	}
+}
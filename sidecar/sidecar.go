@@ -0,0 +1,147 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+// Suffix is appended to the name of an archived file to get the name of its sidecar
+const Suffix = ".meta.json"
+
+// Sidecar contains everything known about an archived file. It is stored next to the file, so the archive can be rebuilt without archive.json
+type Sidecar struct {
+	Guid        string          `json:"guid"`
+	Account     string          `json:"account,omitempty"`
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Link        string          `json:"link"`
+	PubDate     time.Time       `json:"pub_date"`
+	Enclosure   feed.Enclosure  `json:"enclosure"`
+	Attributes  feed.Attributes `json:"attributes"`
+	SourceUrl   string          `json:"source_url"`
+	Embed       string          `json:"embed,omitempty"`
+	Snapshot    string          `json:"snapshot,omitempty"`
+	Filename    string          `json:"filename"`
+	MimeType    string          `json:"mime_type,omitempty"`
+	Size        int64           `json:"size"`
+	Sha256      string          `json:"sha256"`
+	PHash       string          `json:"phash,omitempty"`
+	Thumbnail   string          `json:"thumbnail,omitempty"`
+}
+
+// New combines the feed item with the db item produced when archiving it
+func New(i feed.Item, item db.Item) Sidecar {
+	return Sidecar{
+		Guid:        i.Guid,
+		Account:     item.Account,
+		Title:       i.Title,
+		Description: i.Description,
+		Link:        i.Link,
+		PubDate:     i.PubDate.Time,
+		Enclosure:   i.Enclosure,
+		Attributes:  i.Attributes,
+		SourceUrl:   item.SourceUrl,
+		Embed:       item.Embed,
+		Snapshot:    item.Snapshot,
+		Filename:    item.Filename,
+		MimeType:    item.MimeType,
+		Size:        item.Size,
+		Sha256:      item.Sha256,
+		PHash:       item.PHash,
+		Thumbnail:   item.Thumbnail,
+	}
+}
+
+// Item produces the db item described by the sidecar
+func (s Sidecar) Item() db.Item {
+	return db.Item{
+		Guid:      s.Guid,
+		Account:   s.Account,
+		Timestamp: s.PubDate.Unix(),
+		Filename:  s.Filename,
+		Size:      s.Size,
+		MimeType:  s.MimeType,
+		Sha256:    s.Sha256,
+		SourceUrl: s.SourceUrl,
+		Link:      s.Link,
+		Embed:     s.Embed,
+		Snapshot:  s.Snapshot,
+		PHash:     s.PHash,
+		Thumbnail: s.Thumbnail,
+	}
+}
+
+// Write stores the sidecar next to the archived file in the given directory. When the file is shared with another item,
+// e.g. a linked repost, the sidecar of that item is kept and a counter is appended to the name, like a.gif-1.meta.json
+func Write(dir string, s Sidecar) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := s.Filename
+	for n := 1; ; n++ {
+		other, err := Read(dir, name)
+		if os.IsNotExist(err) || (err == nil && other.Guid == s.Guid) {
+			break
+		}
+		name = s.Filename + "-" + strconv.Itoa(n)
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name+Suffix), data, 0644)
+}
+
+// Read reads the sidecar of the archived file with the given name
+func Read(dir, filename string) (Sidecar, error) {
+	var s Sidecar
+	data, err := ioutil.ReadFile(filepath.Join(dir, filename+Suffix))
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+
+	return s, err
+}
+
+// Reindex rebuilds the list of archived items from all sidecars in the given directory.
+// Sidecars that can not be read or whose file is missing are reported as errors and left out
+func Reindex(dir string) ([]db.Item, []error) {
+	var items []db.Item
+	var errs []error
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), Suffix) {
+			continue
+		}
+		filename := strings.TrimSuffix(f.Name(), Suffix)
+		s, err := Read(dir, filename)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("Error reading %s: %s", f.Name(), err)))
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, s.Filename)); err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("Missing file %s described by %s", s.Filename, f.Name())))
+			continue
+		}
+		items = append(items, s.Item())
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Timestamp < items[j].Timestamp })
+
+	return items, errs
+}
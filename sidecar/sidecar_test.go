@@ -0,0 +1,104 @@
+package sidecar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/feed"
+)
+
+func tempArchive(t *testing.T) string {
+	dir := filepath.Join(os.TempDir(), "souparchive-sidecar-test")
+	os.RemoveAll(dir)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal("Could not create temp dir. Error in test!", err)
+	}
+
+	return dir
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir := tempArchive(t)
+	defer os.RemoveAll(dir)
+
+	i := feed.Item{Guid: "guid1", Link: "http://foo.soup.io/post/1"}
+	i.PubDate = feed.PubDate{Time: time.Unix(100, 0)}
+	i.Attributes.Url = "http://example.com/a.gif"
+	item := db.Item{Guid: "guid1", Timestamp: 100, Filename: "a.gif", Size: 3, Sha256: "abc", SourceUrl: "http://example.com/a.gif", Link: "http://foo.soup.io/post/1", PHash: "8f373714acfcf4d0", Thumbnail: "a.gif.png"}
+
+	err := Write(dir, New(i, item))
+	if err != nil {
+		t.Fatal("Expected sidecar to be written, got", err)
+	}
+
+	s, err := Read(dir, "a.gif")
+	if err != nil {
+		t.Fatal("Expected sidecar to be read, got", err)
+	}
+	if s.Guid != "guid1" || s.Link != "http://foo.soup.io/post/1" || s.SourceUrl != "http://example.com/a.gif" || s.Sha256 != "abc" {
+		t.Fatalf("Sidecar not read correctly: %+v", s)
+	}
+	if !reflect.DeepEqual(s.Item(), item) {
+		t.Fatalf("Expected item %+v from sidecar, got %+v", item, s.Item())
+	}
+}
+
+func TestReindex(t *testing.T) {
+	dir := tempArchive(t)
+	defer os.RemoveAll(dir)
+
+	for _, f := range []struct {
+		guid, filename string
+		timestamp      int64
+	}{{"new", "b.gif", 200}, {"old", "a.gif", 100}} {
+		i := feed.Item{Guid: f.guid}
+		i.PubDate = feed.PubDate{Time: time.Unix(f.timestamp, 0)}
+		Write(dir, New(i, db.Item{Guid: f.guid, Filename: f.filename}))
+		ioutil.WriteFile(filepath.Join(dir, f.filename), []byte("GIF"), 0644)
+	}
+	// sidecar without file
+	Write(dir, Sidecar{Guid: "missing", Filename: "c.gif"})
+	// unrelated json in the archive directory
+	ioutil.WriteFile(filepath.Join(dir, "archive.json"), []byte("{}"), 0644)
+
+	items, errs := Reindex(dir)
+	if len(errs) != 1 {
+		t.Fatal("Expected one error for the missing file, got", errs)
+	}
+	if len(items) != 2 {
+		t.Fatal("Expected 2 items, got", len(items))
+	}
+	if items[0].Guid != "old" || items[1].Guid != "new" {
+		t.Fatalf("Expected items to be ordered by time, got %s, %s", items[0].Guid, items[1].Guid)
+	}
+}
+
+func TestWriteSharedFile(t *testing.T) {
+	dir := tempArchive(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.gif"), []byte("GIF"), 0644)
+
+	for _, guid := range []string{"original", "repost", "repost"} {
+		err := Write(dir, Sidecar{Guid: guid, Filename: "a.gif"})
+		if err != nil {
+			t.Fatal("Expected sidecar to be written, got", err)
+		}
+	}
+
+	if s, _ := Read(dir, "a.gif"); s.Guid != "original" {
+		t.Fatal("Expected the sidecar of the original to be kept, got", s.Guid)
+	}
+	if s, _ := Read(dir, "a.gif-1"); s.Guid != "repost" {
+		t.Fatal("Expected the sidecar of the repost next to it, got", s.Guid)
+	}
+	items, errs := Reindex(dir)
+	if len(errs) != 0 || len(items) != 2 {
+		t.Fatal("Expected both items to be reindexed, got", items, errs)
+	}
+}
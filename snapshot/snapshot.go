@@ -0,0 +1,340 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxResourceSize limits the size of the page and of every stylesheet and image inlined into it
+const MaxResourceSize = 10 << 20
+
+// MaxInlineSize limits the size of all stylesheets and images inlined into a page together. Once it is reached,
+// further resources are referenced by their absolute url
+const MaxInlineSize = 50 << 20
+
+// maxImportDepth limits how deep @import rules of stylesheets are followed
+const maxImportDepth = 3
+
+// Getter downloads the page and its resources. It returns the body and the Content-Type header
+type Getter interface {
+	Get(ctx context.Context, url string) ([]byte, string, error)
+}
+
+var (
+	// dropped are elements that either do not work in a snapshot, would load something from the original site or run
+	// code. Scripts of svg images may be self-closing, animations of svg images may change links to javascript: urls
+	dropped    = regexp.MustCompile(`(?is)<(?:\w+:)?script\b[^>]*/\s*>|<(?:\w+:)?script\b.*?</(?:\w+:)?script\s*>|<(?:iframe|object|applet)\b.*?</(?:iframe|object|applet)\s*>|<(?:noscript|/noscript|base|embed|frame|frameset|/frameset|set|animate|animateMotion|animateTransform)\b[^>]*>|<meta\s[^>]*http-equiv\s*=\s*["']?(?:refresh|content-security-policy)\b[^>]*>`)
+	styleBlock = regexp.MustCompile(`(?is)(<style\b[^>]*>)(.*?)(</style\s*>)`)
+	tag        = regexp.MustCompile(`(?is)<(img|source|input|video|link|a|area)\b[^>]*>`)
+	baseHref   = regexp.MustCompile(`(?is)<base\b[^>]*>`)
+	cssImport  = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?["']?([^"')\s;]+)["']?\s*\)?[^;]*;`)
+	cssUrl     = regexp.MustCompile(`(?i)url\(\s*["']?([^"')]+?)["']?\s*\)`)
+	hasCharset = regexp.MustCompile(`(?i)<meta\b[^>]*charset`)
+	headStart  = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+	element    = regexp.MustCompile(`(?is)<[a-z][a-z0-9:-]*\b[^>]*>`)
+	handler    = regexp.MustCompile(`(?is)([\s/"'])on[a-z0-9_-]*\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// urlAttrs are the attributes that refer to other resources or pages. Only http and https urls are kept in them,
+// data uris only in those loading images. Inlining only replaces them by data uris or the urls kept here
+var urlAttrs = map[string]bool{"href": false, "xlink:href": false, "action": false, "formaction": false, "data": false, "src": true, "data-src": true, "poster": true, "background": true}
+
+// snapshot holds the state while a single page is inlined
+type snapshot struct {
+	ctx    context.Context
+	get    Getter
+	inline map[string]string
+	// size is the number of bytes inlined so far
+	size int
+}
+
+// Page downloads the html page at the given url and produces a single self-contained html file of it.
+// Stylesheets and images are inlined, scripts and frames removed and links made absolute.
+// Resources that can not be downloaded are referenced by their absolute url instead
+func Page(ctx context.Context, g Getter, pageUrl string, now time.Time) ([]byte, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	data, contentType, err := g.Get(ctx, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	t, params, _ := mime.ParseMediaType(contentType)
+	if contentType == "" {
+		t, params, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if t != "text/html" && t != "application/xhtml+xml" {
+		return nil, errors.New(fmt.Sprintf("%s is not an html page but %s", pageUrl, t))
+	}
+
+	page := string(data)
+	if b := baseHref.FindString(page); b != "" {
+		if href, ok := attr(b, "href"); ok {
+			if u, err := base.Parse(href); err == nil {
+				base = u
+			}
+		}
+	}
+
+	s := snapshot{ctx: ctx, get: g, inline: map[string]string{}}
+	page = sanitize(page, base)
+	page = styleBlock.ReplaceAllStringFunc(page, func(block string) string {
+		m := styleBlock.FindStringSubmatch(block)
+		return m[1] + s.css(m[2], base, 0) + m[3]
+	})
+	page = tag.ReplaceAllStringFunc(page, func(t string) string {
+		return s.tag(t, base)
+	})
+
+	header := fmt.Sprintf("<!-- snapshot of %s taken %s -->\n", strings.Replace(pageUrl, "--", "%2D%2D", -1), now.UTC().Format(time.RFC3339))
+	if charset := params["charset"]; charset != "" && !hasCharset.MatchString(page) {
+		meta := `<meta charset="` + html.EscapeString(charset) + `">`
+		if loc := headStart.FindStringIndex(page); loc != nil {
+			page = page[:loc[1]] + meta + page[loc[1]:]
+		} else {
+			header += meta + "\n"
+		}
+	}
+
+	return []byte(header + page), nil
+}
+
+// tag rewrites a single tag that references another resource
+func (s *snapshot) tag(t string, base *url.URL) string {
+	name := strings.ToLower(tag.FindStringSubmatch(t)[1])
+	if style, ok := attr(t, "style"); ok && strings.Contains(style, "url(") {
+		t = setAttr(t, "style", s.css(style, base, maxImportDepth))
+	}
+
+	switch name {
+	case "a", "area":
+		if href, ok := attr(t, "href"); ok && !strings.HasPrefix(href, "#") {
+			t = setAttr(t, "href", absolute(base, href))
+		}
+	case "link":
+		rel, _ := attr(t, "rel")
+		href, ok := attr(t, "href")
+		if !ok || !hasToken(rel, "stylesheet") {
+			// icons, preloads and the like are of no use in a snapshot
+			return ""
+		}
+		u := absolute(base, href)
+		css, _, err := s.fetch(u)
+		if err != nil {
+			return setAttr(t, "href", u)
+		}
+		s.size += len(css)
+		ref, _ := url.Parse(u)
+		media := ""
+		if m, ok := attr(t, "media"); ok {
+			media = ` media="` + html.EscapeString(m) + `"`
+		}
+		return "<style" + media + ">" + s.css(string(css), ref, 0) + "</style>"
+	case "video":
+		if poster, ok := attr(t, "poster"); ok {
+			t = setAttr(t, "poster", s.dataUri(absolute(base, poster)))
+		}
+	default:
+		// lazy loading images keep the actual image in data-src
+		src, ok := attr(t, "data-src")
+		if !ok {
+			src, ok = attr(t, "src")
+		}
+		if ok && !strings.HasPrefix(src, "data:") {
+			t = setAttr(t, "src", s.dataUri(absolute(base, src)))
+		}
+		t = removeAttr(removeAttr(t, "srcset"), "data-srcset")
+	}
+
+	return t
+}
+
+// css inlines imported stylesheets and the resources referenced via url() of a stylesheet found at base
+func (s *snapshot) css(css string, base *url.URL, depth int) string {
+	css = cssImport.ReplaceAllStringFunc(css, func(rule string) string {
+		if depth >= maxImportDepth {
+			return ""
+		}
+		u := absolute(base, cssImport.FindStringSubmatch(rule)[1])
+		imported, _, err := s.fetch(u)
+		if err != nil {
+			return ""
+		}
+		s.size += len(imported)
+		ref, _ := url.Parse(u)
+		return s.css(string(imported), ref, depth+1)
+	})
+	css = cssUrl.ReplaceAllStringFunc(css, func(ref string) string {
+		u := strings.TrimSpace(cssUrl.FindStringSubmatch(ref)[1])
+		if strings.HasPrefix(u, "data:") || strings.HasPrefix(u, "#") {
+			return ref
+		}
+		return `url("` + s.dataUri(absolute(base, u)) + `")`
+	})
+
+	// a stylesheet must not be able to end the style element it is inlined into
+	return strings.Replace(css, "</", `<\/`, -1)
+}
+
+// dataUri downloads the resource at the absolute url and encodes it as data uri. On failure or once MaxInlineSize
+// is reached the url itself is returned. Every use counts, as a resource is inlined as often as it is referenced
+func (s *snapshot) dataUri(u string) string {
+	inlined, ok := s.inline[u]
+	if !ok {
+		inlined = u
+		if data, contentType, err := s.fetch(u); err == nil {
+			inlined = "data:" + mediaType(data, contentType) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}
+		s.inline[u] = inlined
+	}
+	if s.size+len(inlined) > MaxInlineSize {
+		return u
+	}
+	s.size += len(inlined)
+
+	return inlined
+}
+
+// mediaType decides on the type of an inlined resource. The Content-Type header is trusted unless it is generic,
+// otherwise the type is sniffed. http.DetectContentType does not know svg
+func mediaType(data []byte, header string) string {
+	if t, _, err := mime.ParseMediaType(header); err == nil && t != "application/octet-stream" && t != "text/plain" {
+		return t
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	if bytes.Contains(head, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	t, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	return t
+}
+
+// fetch downloads a resource of the page and returns it with its Content-Type. Only http and https are followed
+func (s *snapshot) fetch(u string) ([]byte, string, error) {
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return nil, "", errors.New("unsupported url " + u)
+	}
+	if s.size >= MaxInlineSize {
+		return nil, "", errors.New("snapshot is too large to inline " + u)
+	}
+	data, contentType, err := s.get.Get(s.ctx, u)
+	if err == nil && (len(data) > MaxResourceSize || s.size+len(data) > MaxInlineSize) {
+		err = errors.New(u + " is too large")
+	}
+
+	return data, contentType, err
+}
+
+// sanitize removes everything that could run code from the page. Removing something may form new elements or
+// attributes out of the remains, like <scr<script></script>ipt>, so it is repeated until nothing changes
+func sanitize(page string, base *url.URL) string {
+	for {
+		clean := dropped.ReplaceAllString(page, "")
+		clean = element.ReplaceAllStringFunc(clean, func(t string) string {
+			return harmless(t, base)
+		})
+		if clean == page {
+			return clean
+		}
+		page = clean
+	}
+}
+
+// harmless removes event handlers from a tag and all urls that could run code when followed or loaded, like
+// javascript: urls. Relative urls are judged by the url they resolve to
+func harmless(t string, base *url.URL) string {
+	t = without(handler, t)
+	lower := strings.ToLower(t)
+	for name, image := range urlAttrs {
+		if !strings.Contains(lower, name) {
+			continue
+		}
+		v, ok := attr(t, name)
+		if !ok || strings.HasPrefix(v, "#") {
+			continue
+		}
+		u, err := url.Parse(absolute(base, v))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && !(image && u.Scheme == "data")) {
+			t = removeAttr(t, name)
+		}
+	}
+
+	return t
+}
+
+// absolute resolves a reference found in the page against its base url
+func absolute(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+
+	return u.String()
+}
+
+// hasToken tells whether the space separated list, like the rel attribute, contains the token
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// attrPattern matches the attribute with the given name inside a tag. Browsers accept attributes after a slash
+// or right after the quoted value of the previous one as well, the first group is that separator
+func attrPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?is)([\s/"'])` + regexp.QuoteMeta(name) + `\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+}
+
+// attr returns the unescaped value of the attribute with the given name
+func attr(t, name string) (string, bool) {
+	m := attrPattern(name).FindStringSubmatch(t)
+	if m == nil {
+		return "", false
+	}
+
+	return html.UnescapeString(strings.Trim(m[2], `"'`)), true
+}
+
+// setAttr sets the value of the attribute with the given name, adding it if needed
+func setAttr(t, name, value string) string {
+	a := ` ` + name + `="` + html.EscapeString(value) + `"`
+	p := attrPattern(name)
+	if loc := p.FindStringSubmatchIndex(t); loc != nil {
+		separator := strings.TrimSpace(t[loc[2]:loc[3]])
+		return t[:loc[0]] + separator + a + t[loc[1]:]
+	}
+	end := strings.TrimRight(strings.TrimSuffix(strings.TrimSuffix(t, ">"), "/"), " \t\r\n")
+
+	return end + a + t[len(end):]
+}
+
+// removeAttr removes the attribute with the given name
+func removeAttr(t, name string) string {
+	return without(attrPattern(name), t)
+}
+
+// without removes all attributes matched by p. A quote or slash separating them from the previous attribute stays
+func without(p *regexp.Regexp, t string) string {
+	return p.ReplaceAllStringFunc(t, func(a string) string {
+		return strings.TrimSpace(a[:1])
+	})
+}
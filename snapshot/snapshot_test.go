@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGetter serves the resources of a page from memory
+type testGetter map[string][2]string
+
+func (g testGetter) Get(ctx context.Context, url string) ([]byte, string, error) {
+	r, ok := g[url]
+	if !ok {
+		return nil, "", errors.New("not found")
+	}
+
+	return []byte(r[0]), r[1], nil
+}
+
+const gif = "GIF89a\x01\x00\x01\x00"
+
+func TestPage(t *testing.T) {
+	g := testGetter{
+		"http://example.com/blog/article": {`<html><head><title>Article</title>
+<link rel="stylesheet" href="/style.css" media="screen">
+<link rel="icon" href="/favicon.ico">
+<script>alert("tracking")</script>
+<style>body { background: url('bg.gif') }</style>
+</head><body>
+<img src="a.gif" srcset="a-2x.gif 2x" alt="a">
+<img src="data:image/gif;base64,R0lG" data-src="lazy.gif">
+<img src="missing.gif">
+<a href="../other">other article</a> <a href="#top">top</a>
+<iframe src="http://ads.example.com/"></iframe>
+</body></html>`, "text/html; charset=iso-8859-1"},
+		"http://example.com/style.css":     {`@import "fonts.css"; h1 { background: url(/img/h1.gif) }</style><script>`, "text/css"},
+		"http://example.com/fonts.css":     {`@font-face { src: url(font.woff) }`, "text/css"},
+		"http://example.com/font.woff":     {"wOFF", "font/woff"},
+		"http://example.com/img/h1.gif":    {gif, "image/gif"},
+		"http://example.com/blog/bg.gif":   {gif, ""},
+		"http://example.com/blog/a.gif":    {gif, "image/gif"},
+		"http://example.com/blog/lazy.gif": {gif, "application/octet-stream"},
+		"http://example.com/blog/a-2x.gif": {gif, "image/gif"},
+		"http://example.com/favicon.ico":   {gif, "image/x-icon"},
+		"http://ads.example.com/":          {"<html></html>", "text/html"},
+	}
+	data := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte(gif))
+
+	out, err := Page(context.Background(), g, "http://example.com/blog/article", time.Unix(1487859269, 0))
+	if err != nil {
+		t.Fatal("Expected snapshot to be taken, got", err)
+	}
+	page := string(out)
+
+	for _, expected := range []string{
+		"<!-- snapshot of http://example.com/blog/article taken 2017-02-23T14:14:29Z -->",
+		`<head><meta charset="iso-8859-1">`,
+		`<style media="screen">`,
+		`url("data:font/woff;base64,` + base64.StdEncoding.EncodeToString([]byte("wOFF")) + `")`,
+		`h1 { background: url("` + data + `") }<\/style><script>`,
+		`body { background: url("` + data + `") }`,
+		`<img src="` + data + `" alt="a">`,
+		`<img src="` + data + `" data-src="lazy.gif">`,
+		`<img src="http://example.com/blog/missing.gif">`,
+		`<a href="http://example.com/other">`,
+		`<a href="#top">`,
+	} {
+		if !strings.Contains(page, expected) {
+			t.Fatalf("Expected snapshot to contain %s, got %s", expected, page)
+		}
+	}
+	for _, unexpected := range []string{"alert", "<iframe", "favicon", "srcset", "@import", "<link"} {
+		if strings.Contains(page, unexpected) {
+			t.Fatalf("Expected %s to be removed from snapshot, got %s", unexpected, page)
+		}
+	}
+}
+
+func TestPageNeedsHtml(t *testing.T) {
+	g := testGetter{"http://example.com/paper.pdf": {"%PDF-1.4", "application/pdf"}}
+
+	_, err := Page(context.Background(), g, "http://example.com/paper.pdf", time.Now())
+	if err == nil {
+		t.Fatal("Expected error for a pdf, got nil")
+	}
+	_, err = Page(context.Background(), g, "http://example.com/gone", time.Now())
+	if err == nil {
+		t.Fatal("Expected error for a missing page, got nil")
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	tag := `<img alt='a &amp; b' src=a.gif>`
+	if v, ok := attr(tag, "alt"); !ok || v != "a & b" {
+		t.Fatal("Expected unescaped alt, got", v)
+	}
+	if v, ok := attr(tag, "src"); !ok || v != "a.gif" {
+		t.Fatal("Expected unquoted src, got", v)
+	}
+	if _, ok := attr(tag, "srcset"); ok {
+		t.Fatal("Expected missing srcset not to be found")
+	}
+	if v := setAttr(tag, "src", `b".gif`); v != `<img alt='a &amp; b' src="b&#34;.gif">` {
+		t.Fatal("Expected src to be replaced, got", v)
+	}
+	if v := setAttr(`<img alt="x" />`, "src", "c.gif"); v != `<img alt="x" src="c.gif" />` {
+		t.Fatal("Expected src to be added, got", v)
+	}
+	if v := removeAttr(tag, "alt"); v != `<img src=a.gif>` {
+		t.Fatal("Expected alt to be removed, got", v)
+	}
+	if v := removeAttr(`<img alt="a"src=a.gif>`, "src"); v != `<img alt="a">` {
+		t.Fatal("Expected src right after another attribute to be removed, got", v)
+	}
+	if v := setAttr(`<img/src=a.gif>`, "src", "b.gif"); v != `<img/ src="b.gif">` {
+		t.Fatal("Expected src after a slash to be replaced, got", v)
+	}
+}
+
+func TestPageRemovesCode(t *testing.T) {
+	g := testGetter{
+		"http://example.com/": {`<html><body onload="alert(1)">
+<a href="javascript:alert(2)" onclick='alert(3)'>click</a>
+<a href=" JavaScript:alert(4)">click</a>
+<img src="javascript:alert(5)" onerror=alert(6)><img data-src="javascript:alert(12)">
+<form action="data:text/html,alert7"><button formaction="vbscript:alert8">send</button></form>
+<audio src="sound.mp3"></audio>
+<object data="movie.swf"><embed src="movie.swf"></object>
+<svg><script href="http://example.com/alert.js"/><svg:script>alert(9)</svg:script>
+<a xlink:href="javascript:alert(10)"><set attributeName="href" to="javascript:alert(11)"/>link</a></svg>
+<scr<script></script>ipt>alert(13)</script>
+<svg/onload=alert(14)><img/src=x/onerror=alert(15)>
+<img src="x"onerror="alert(16)"><a/href=javascript:alert(17)>click</a>
+<frameset><frame src="http://example.com/frame"></frameset>
+</body></html>`, "text/html"},
+	}
+
+	out, err := Page(context.Background(), g, "http://example.com/", time.Now())
+	if err != nil {
+		t.Fatal("Expected snapshot to be taken, got", err)
+	}
+	page := string(out)
+
+	for _, unexpected := range []string{"alert", "onload", "onclick", "onerror", "<object", "<embed", "<script", "<svg:script", "<set", "action=", "<frame", "ipt>"} {
+		if strings.Contains(strings.ToLower(page), unexpected) {
+			t.Fatalf("Expected %s to be removed from snapshot, got %s", unexpected, page)
+		}
+	}
+	if !strings.Contains(page, `<audio src="sound.mp3">`) || !strings.Contains(page, "<button>send</button>") {
+		t.Fatal("Expected other urls and elements to be kept, got", page)
+	}
+}
+
+func TestPageLimitsInlinedSize(t *testing.T) {
+	image := gif + strings.Repeat("x", 1<<20)
+	g := testGetter{
+		"http://example.com/":      {`<html><body>` + strings.Repeat(`<img src="a.gif">`, 60) + `</body></html>`, "text/html"},
+		"http://example.com/a.gif": {image, "image/gif"},
+	}
+
+	out, err := Page(context.Background(), g, "http://example.com/", time.Now())
+	if err != nil {
+		t.Fatal("Expected snapshot to be taken, got", err)
+	}
+	if len(out) > MaxInlineSize+1<<20 {
+		t.Fatal("Expected inlined resources to be limited, got", len(out))
+	}
+	if !strings.Contains(string(out), `<img src="data:image/gif;base64,`) || !strings.Contains(string(out), `<img src="http://example.com/a.gif">`) {
+		t.Fatal("Expected the image to be inlined until the limit is reached and referenced afterwards")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	base, _ := url.Parse("http://example.com/")
+	for page, expected := range map[string]string{
+		`<scr<script></script>ipt>alert(1)</script>`: ``,
+		`<svg/onload=alert(2)>`:                      `<svg/>`,
+		`<img/src=x/onerror=alert(3)>`:               `<img/src=x/>`,
+		`<img src="x"onerror="alert(4)">`:            `<img src="x">`,
+		`<a/href=javascript:alert(5)>`:               `<a/>`,
+		`<a href="#top" title="on top">`:             `<a href="#top" title="on top">`,
+	} {
+		if clean := sanitize(page, base); clean != expected {
+			t.Fatalf("Expected %s to be sanitized to %s, got %s", page, expected, clean)
+		}
+	}
+}
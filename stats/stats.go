@@ -0,0 +1,184 @@
+package stats
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+)
+
+// DefaultTop is the default length of the lists of largest files, domains and repost sources
+const DefaultTop = 10
+
+// Count is the number of items and their size for one media type, month, domain or repost source
+type Count struct {
+	Name  string `json:"name"`
+	Items int    `json:"items"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Failures are the fetch results of all runs for one account
+type Failures struct {
+	Account string  `json:"account"`
+	Fetched int64   `json:"fetched"`
+	Failed  int64   `json:"failed"`
+	Rate    float64 `json:"rate"`
+}
+
+// Stats summarizes an archive
+type Stats struct {
+	Items  int   `json:"items"`
+	Bytes  int64 `json:"bytes"`
+	Oldest int64 `json:"oldest"`
+	Newest int64 `json:"newest"`
+	// ByType and ByDomain are sorted by number of items, ByMonth chronologically
+	ByType   []Count `json:"by_type"`
+	ByMonth  []Count `json:"by_month"`
+	ByDomain []Count `json:"by_domain"`
+	// RepostSources are the sites of the original posts of reposts, sorted by number of items
+	RepostSources []Count    `json:"repost_sources"`
+	Largest       []db.Item  `json:"largest"`
+	Failures      []Failures `json:"failures"`
+}
+
+// Compute summarizes the items and the fetch results in the store. The lists of largest files, domains
+// and repost sources are limited to top entries. Files shared by several items, like linked reposts, are
+// only counted once towards the sizes and the largest files
+func Compute(items []db.Item, store metrics.Store, top int) Stats {
+	s := Stats{Items: len(items)}
+	byType := map[string]*Count{}
+	byMonth := map[string]*Count{}
+	byDomain := map[string]*Count{}
+	reposts := map[string]*Count{}
+	files := map[string]bool{}
+	s.Largest = []db.Item{}
+
+	for _, i := range items {
+		size := int64(0)
+		if !files[i.Filename] {
+			files[i.Filename] = true
+			size = i.Size
+			s.Largest = append(s.Largest, i)
+		}
+		s.Bytes += size
+		if s.Oldest == 0 || i.Timestamp < s.Oldest {
+			s.Oldest = i.Timestamp
+		}
+		if i.Timestamp > s.Newest {
+			s.Newest = i.Timestamp
+		}
+
+		t := i.MimeType
+		if t == "" {
+			t = "unknown"
+		}
+		add(byType, t, size)
+		add(byMonth, time.Unix(i.Timestamp, 0).UTC().Format("2006-01"), size)
+		add(byDomain, host(i.SourceUrl), size)
+		if source, ok := repostSource(i); ok {
+			add(reposts, source, size)
+		}
+	}
+
+	s.ByType = sorted(byType, 0)
+	s.ByDomain = sorted(byDomain, top)
+	s.RepostSources = sorted(reposts, top)
+	s.ByMonth = []Count{}
+	for _, c := range byMonth {
+		s.ByMonth = append(s.ByMonth, *c)
+	}
+	sort.Slice(s.ByMonth, func(a, b int) bool { return s.ByMonth[a].Name < s.ByMonth[b].Name })
+
+	sort.SliceStable(s.Largest, func(a, b int) bool { return s.Largest[a].Size > s.Largest[b].Size })
+	if len(s.Largest) > top {
+		s.Largest = s.Largest[:top]
+	}
+
+	s.Failures = []Failures{}
+	for account, a := range store.Accounts {
+		f := Failures{Account: account, Fetched: a.Fetched, Failed: a.Failed}
+		if a.Fetched+a.Failed > 0 {
+			f.Rate = float64(a.Failed) / float64(a.Fetched+a.Failed)
+		}
+		s.Failures = append(s.Failures, f)
+	}
+	sort.Slice(s.Failures, func(a, b int) bool { return s.Failures[a].Account < s.Failures[b].Account })
+
+	return s
+}
+
+// add counts an item of the given size
+func add(counts map[string]*Count, name string, size int64) {
+	c, ok := counts[name]
+	if !ok {
+		c = &Count{Name: name}
+		counts[name] = c
+	}
+	c.Items++
+	c.Bytes += size
+}
+
+// sorted lists the counts by number of items, largest first. Ties are sorted by name. top limits the list unless it is 0
+func sorted(counts map[string]*Count, top int) []Count {
+	list := []Count{}
+	for _, c := range counts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].Items != list[b].Items {
+			return list[a].Items > list[b].Items
+		}
+		return list[a].Name < list[b].Name
+	})
+	if top > 0 && len(list) > top {
+		list = list[:top]
+	}
+
+	return list
+}
+
+// host returns the host name of the url or unknown
+func host(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// repostSource tells where a repost has been reposted from. An item is a repost, if the post it links to is
+// on another site than the item itself
+func repostSource(i db.Item) (string, bool) {
+	if i.Link == "" {
+		return "", false
+	}
+	source := host(i.Link)
+	if source == "unknown" || source == host(i.Guid) {
+		return "", false
+	}
+
+	return source, true
+}
+
+// FormatBytes prints a size in human readable units. Negative sizes are unknown
+func FormatBytes(n int64) string {
+	if n < 0 {
+		return "unknown size"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
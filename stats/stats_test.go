@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+)
+
+func TestCompute(t *testing.T) {
+	items := []db.Item{
+		{Guid: "http://foo.soup.io/post/1", Timestamp: 1487859269, Filename: "a.gif", MimeType: "image/gif", Size: 100, SourceUrl: "http://asset.soup.io/a.gif", Link: "http://foo.soup.io/post/1"},
+		{Guid: "http://foo.soup.io/post/2", Timestamp: 1487945669, Filename: "b.gif", MimeType: "image/gif", Size: 300, SourceUrl: "http://asset.soup.io/b.gif", Link: "http://bar.soup.io/post/9"},
+		{Guid: "http://foo.soup.io/post/3", Timestamp: 1490000000, Filename: "c.jpg", MimeType: "image/jpeg", Size: 200, SourceUrl: "https://www.example.com/c.jpg", Link: "http://bar.soup.io/post/10"},
+		{Guid: "http://foo.soup.io/post/4", Timestamp: 1490000001, Filename: "d.bin", Size: 50},
+	}
+	store := metrics.NewStore("")
+	store.Accounts["foo"] = metrics.Account{Fetched: 3, Failed: 1}
+
+	s := Compute(items, store, 2)
+
+	if s.Items != 4 || s.Bytes != 650 || s.Oldest != 1487859269 || s.Newest != 1490000001 {
+		t.Fatalf("Wrong totals: %+v", s)
+	}
+	if len(s.ByType) != 3 || s.ByType[0] != (Count{Name: "image/gif", Items: 2, Bytes: 400}) || s.ByType[2].Name != "unknown" {
+		t.Fatal("Expected counts by type, most items first, got", s.ByType)
+	}
+	if len(s.ByMonth) != 2 || s.ByMonth[0].Name != "2017-02" || s.ByMonth[1].Items != 2 {
+		t.Fatal("Expected counts by month in order, got", s.ByMonth)
+	}
+	if len(s.ByDomain) != 2 || s.ByDomain[0].Name != "asset.soup.io" || s.ByDomain[1].Name != "example.com" {
+		t.Fatal("Expected top 2 domains, got", s.ByDomain)
+	}
+	if len(s.RepostSources) != 1 || s.RepostSources[0] != (Count{Name: "bar.soup.io", Items: 2, Bytes: 500}) {
+		t.Fatal("Expected reposts from bar.soup.io, got", s.RepostSources)
+	}
+	if len(s.Largest) != 2 || s.Largest[0].Filename != "b.gif" || s.Largest[1].Filename != "c.jpg" {
+		t.Fatal("Expected 2 largest files, got", s.Largest)
+	}
+	if len(s.Failures) != 1 || s.Failures[0].Rate != 0.25 {
+		t.Fatal("Expected failure rate of 25%, got", s.Failures)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[int64]string{-1: "unknown size", 0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 3 << 30: "3.0 GiB"} {
+		if s := FormatBytes(n); s != expected {
+			t.Fatalf("Expected %s for %d, got %s", expected, n, s)
+		}
+	}
+}
+
+func TestComputeCountsSharedFilesOnce(t *testing.T) {
+	items := []db.Item{
+		{Guid: "original", Timestamp: 100, Filename: "a.gif", MimeType: "image/gif", Size: 100},
+		{Guid: "repost", Timestamp: 200, Filename: "a.gif", MimeType: "image/gif", Size: 100},
+		{Guid: "other", Timestamp: 300, Filename: "b.gif", MimeType: "image/gif", Size: 50},
+	}
+
+	s := Compute(items, metrics.NewStore(""), DefaultTop)
+
+	if s.Items != 3 || s.Bytes != 150 {
+		t.Fatalf("Expected 3 items in 150 bytes, got %+v", s)
+	}
+	if s.ByType[0] != (Count{Name: "image/gif", Items: 3, Bytes: 150}) {
+		t.Fatal("Expected the shared file to be counted once by type, got", s.ByType)
+	}
+	if len(s.Largest) != 2 || s.Largest[0].Guid != "original" || s.Largest[1].Filename != "b.gif" {
+		t.Fatal("Expected every file once among the largest, got", s.Largest)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bestform/souparchive/db"
+	"github.com/bestform/souparchive/metrics"
+	"github.com/bestform/souparchive/stats"
+)
+
+// showStats summarizes the archive and the fetch results of all runs
+func showStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	asJson := fs.Bool("json", false, "print the stats as json")
+	top := fs.Int("top", stats.DefaultTop, "length of the lists of largest files, source domains and repost sources")
+	fs.Parse(args)
+
+	a := db.NewArchive(filepath.Join(*dir, "archive.json"))
+	a.Read()
+	store := metrics.NewStore(filepath.Join(*dir, "metrics.json"))
+	store.Read()
+
+	err := printStats(os.Stdout, stats.Compute(a.Data.Items, store, *top), *asJson)
+	if err != nil {
+		fmt.Println("Error printing stats:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// printStats writes the stats either human readable or as json
+func printStats(w io.Writer, s stats.Stats, asJson bool) error {
+	if asJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	fmt.Fprintf(w, "%d items, %s\n", s.Items, stats.FormatBytes(s.Bytes))
+	if s.Items > 0 {
+		fmt.Fprintf(w, "from %s to %s\n", time.Unix(s.Oldest, 0).UTC().Format("2006-01-02"), time.Unix(s.Newest, 0).UTC().Format("2006-01-02"))
+	}
+
+	sections := []struct {
+		title  string
+		counts []stats.Count
+	}{
+		{"By type", s.ByType},
+		{"By month", s.ByMonth},
+		{"By source domain", s.ByDomain},
+		{"Top repost sources", s.RepostSources},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, c := range section.counts {
+			fmt.Fprintf(w, "  %-30s %6d  %10s\n", c.Name, c.Items, stats.FormatBytes(c.Bytes))
+		}
+	}
+
+	fmt.Fprintf(w, "\nLargest files:\n")
+	for _, i := range s.Largest {
+		fmt.Fprintf(w, "  %-30s %10s  %s\n", i.Filename, stats.FormatBytes(i.Size), i.Guid)
+	}
+
+	fmt.Fprintf(w, "\nFetch failures:\n")
+	for _, f := range s.Failures {
+		fmt.Fprintf(w, "  %-30s %6d of %6d  %5.1f%%\n", f.Account, f.Failed, f.Fetched+f.Failed, f.Rate*100)
+	}
+
+	return nil
+}
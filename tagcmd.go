@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/bestform/souparchive/db"
+)
+
+// tag adds tags to or removes them from the selected items. Without tags it lists all tags in use
+func tag(args []string) int {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	dir := fs.String("archive", "archive", "archive directory")
+	remove := fs.Bool("remove", false, "remove the tags instead of adding them")
+	sel := registerSelectionFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tag [-archive dir] [-remove] [-guid guid]... [-q text] [-from date] [-to date] tag...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	a := db.NewArchive(filepath.Join(*dir, "archive.json"))
+	a.Read()
+
+	if fs.NArg() == 0 {
+		counts := a.Tags()
+		tags := make([]string, 0, len(counts))
+		for t := range counts {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+		for _, t := range tags {
+			fmt.Printf("%s (%d)\n", t, counts[t])
+		}
+		return 0
+	}
+	if sel.empty() {
+		fmt.Println("Select the items to tag via -guid, -q, -from or -to")
+		return 2
+	}
+
+	guids, err := sel.match(a.Data.Items)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	for _, g := range guids {
+		if *remove {
+			a.Untag(g, fs.Args()...)
+		} else {
+			a.Tag(g, fs.Args()...)
+		}
+	}
+	err = a.Persist()
+	if err != nil {
+		fmt.Println("Error persisting archive:", err)
+		return 1
+	}
+
+	if *remove {
+		fmt.Printf("Removed tags from %d items\n", len(guids))
+	} else {
+		fmt.Printf("Tagged %d items\n", len(guids))
+	}
+
+	return 0
+}
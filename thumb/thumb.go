@@ -0,0 +1,142 @@
+package thumb
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register gif decoding for soup's animations
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultWidth is the width of thumbnails if nothing else is specified. It matches the width images are shown with in the hosted archive
+const DefaultWidth = 400
+
+// Dir is the name of the directory inside the archive where thumbnails are cached
+const Dir = "thumbs"
+
+// Name returns the filename of the thumbnail for the archived file with the given name and format
+func Name(filename, format string) string {
+	if format == "png" || format == "gif" {
+		// keep transparency
+		return filename + ".png"
+	}
+
+	return filename + ".jpg"
+}
+
+// Find returns the filename of an already generated thumbnail inside the archive directory or an empty string
+func Find(archiveDir, filename string) string {
+	for _, format := range []string{"jpeg", "png"} {
+		name := Name(filename, format)
+		if _, err := os.Stat(filepath.Join(archiveDir, Dir, name)); err == nil {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// Generate creates a thumbnail of at most the given width for the archived file with the given name.
+// Only the first frame of animated gifs is used. It returns the filename of the thumbnail inside the thumbs directory
+func Generate(archiveDir, filename string, width int) (string, error) {
+	return GenerateInto(filepath.Join(archiveDir, filename), filepath.Join(archiveDir, Dir), width)
+}
+
+// GenerateInto creates a thumbnail of at most the given width for the file at path in the directory dir.
+// It returns the filename of the thumbnail inside dir
+func GenerateInto(path, dir string, width int) (string, error) {
+	filename := filepath.Base(path)
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	img, format, err := image.Decode(src)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Error decoding %s: %s", filename, err))
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name := Name(filename, format)
+	// every caller writes its own temporary file, so concurrent requests for the same thumbnail never rename a partial file into place
+	dst, err := ioutil.TempFile(dir, name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	thumbnail := Resize(img, width)
+	if format == "png" || format == "gif" {
+		err = png.Encode(dst, thumbnail)
+	} else {
+		err = jpeg.Encode(dst, thumbnail, &jpeg.Options{Quality: 85})
+	}
+	dst.Close()
+	if err == nil {
+		err = os.Chmod(dst.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", errors.New(fmt.Sprintf("Error encoding thumbnail for %s: %s", filename, err))
+	}
+
+	return name, os.Rename(dst.Name(), filepath.Join(dir, name))
+}
+
+// Resize scales the image down to the given width keeping the aspect ratio. Smaller images are returned unchanged.
+// Every pixel of the result is the average of the corresponding area in the source
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * b.Dy() / height
+		y1 := (y + 1) * b.Dy() / height
+		for x := 0; x < width; x++ {
+			x0 := x * b.Dx() / width
+			x1 := (x + 1) * b.Dx() / width
+
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					bl += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
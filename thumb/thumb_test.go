@@ -0,0 +1,127 @@
+package thumb
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestResizeKeepsAspectRatio(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 200))
+
+	r := Resize(img, 400)
+	if r.Bounds().Dx() != 400 || r.Bounds().Dy() != 100 {
+		t.Fatalf("Expected 400x100, got %dx%d", r.Bounds().Dx(), r.Bounds().Dy())
+	}
+}
+
+func TestResizeAveragesPixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{200, 200, 200, 255})
+
+	r := Resize(img, 1)
+	c := color.NRGBAModel.Convert(r.At(0, 0)).(color.NRGBA)
+	if c.R != 100 {
+		t.Fatal("Expected averaged red value of 100, got", c.R)
+	}
+}
+
+func TestResizeDoesNotEnlarge(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+
+	r := Resize(img, 400)
+	if r.Bounds().Dx() != 100 {
+		t.Fatal("Expected small image to stay unchanged, got width", r.Bounds().Dx())
+	}
+}
+
+func TestGenerateFromGif(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-thumb-test")
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 800, 400), palette), image.NewPaletted(image.Rect(0, 0, 800, 400), palette)},
+		Delay: []int{10, 10},
+	}
+	f, err := os.Create(filepath.Join(dir, "anim.gif"))
+	if err != nil {
+		t.Fatal("Could not create gif. Error in test!", err)
+	}
+	gif.EncodeAll(f, anim)
+	f.Close()
+
+	name, err := Generate(dir, "anim.gif", 400)
+	if err != nil {
+		t.Fatal("Expected thumbnail to be generated, got", err)
+	}
+	if name != "anim.gif.png" {
+		t.Fatal("Expected thumbnail name 'anim.gif.png', got", name)
+	}
+	if Find(dir, "anim.gif") != name {
+		t.Fatal("Expected generated thumbnail to be found")
+	}
+
+	tf, err := os.Open(filepath.Join(dir, Dir, name))
+	if err != nil {
+		t.Fatal("Expected thumbnail file to exist, got", err)
+	}
+	defer tf.Close()
+	cfg, err := png.DecodeConfig(tf)
+	if err != nil {
+		t.Fatal("Expected thumbnail to be a png, got", err)
+	}
+	if cfg.Width != 400 || cfg.Height != 200 {
+		t.Fatalf("Expected 400x200 thumbnail, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestGenerateFailsOnNonImage(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "souparchive-thumb-test")
+	os.MkdirAll(dir, 0755)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "video.mp4"), []byte("no image"), 0644)
+
+	_, err := Generate(dir, "video.mp4", 400)
+	if err == nil {
+		t.Fatal("Expected error on non image file, got nil")
+	}
+}
+
+func TestGenerateConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	f, _ := os.Create(filepath.Join(dir, "a.png"))
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 800, 800)))
+	f.Close()
+
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Generate(dir, "a.png", 400); err != nil {
+				t.Error("Expected thumbnail to be generated, got", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	files, _ := ioutil.ReadDir(filepath.Join(dir, Dir))
+	if len(files) != 1 || files[0].Name() != "a.png.png" {
+		t.Fatal("Expected only the thumbnail without temporary files, got", files)
+	}
+	tf, _ := os.Open(filepath.Join(dir, Dir, "a.png.png"))
+	defer tf.Close()
+	if _, err := png.Decode(tf); err != nil {
+		t.Fatal("Expected a complete thumbnail, got", err)
+	}
+}